@@ -2,18 +2,29 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"metarr/internal/abstractions"
+	"metarr/internal/api"
 	"metarr/internal/cfg"
+	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/paths"
 	"metarr/internal/domain/vars"
+	"metarr/internal/events"
 	"metarr/internal/file"
+	"metarr/internal/journal"
 	"metarr/internal/models"
+	"metarr/internal/monitor"
+	"metarr/internal/plan"
 	"metarr/internal/processing"
-	"metarr/internal/transformations"
+	"metarr/internal/progress"
+	"metarr/internal/report"
+	"metarr/internal/state"
 	"metarr/internal/utils/prompt"
+	"metarr/internal/watch"
 	"os"
 	"os/signal"
 	"runtime/debug"
@@ -33,6 +44,19 @@ const (
 	elapsedFormat  = "Time elapsed: %.2f seconds\n"
 )
 
+// Exit codes.
+const (
+	exitError          = 1 // Metarr could not start, e.g. invalid settings.
+	exitPartialFailure = 2 // Some files failed.
+	exitTotalFailure   = 3 // No files were processed successfully.
+)
+
+// Run outcomes, returned by runPass when errors were collected.
+var (
+	errPartialFailure = errors.New("some files failed")
+	errTotalFailure   = errors.New("no files were processed successfully")
+)
+
 // init before program run.
 func init() {
 	if err := paths.InitProgFilesDirs(); err != nil {
@@ -45,12 +69,20 @@ func init() {
 func main() {
 	startTime := time.Now()
 
+	// Exit with the run's outcome once everything else has been cleaned up.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	// Setup logging.
 	logConfig := logging.LoggingConfig{
 		LogFilePath: paths.MetarrLogFilePath,
 		MaxSizeMB:   1,
 		MaxBackups:  3,
-		Console:     os.Stderr,
+		Console:     progress.Stderr,
 		Program:     "Metarr",
 	}
 	pl, err := logging.SetupLogging(logConfig)
@@ -79,6 +111,7 @@ func main() {
 	if err := cfg.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintf(os.Stderr, "\n")
+		exitCode = exitError
 		return
 	}
 
@@ -92,34 +125,195 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
 	defer cancel()
 
-	// Log POST goroutine.
-	go func() {
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				logger.SendLogs()
-			}
+	// Push structured events to Tubarr or another listener.
+	if url := abstractions.GetString(keys.EventsURL); url != "" {
+		pusher := events.StartPush(url, abstractions.GetString(keys.EventsToken))
+		defer pusher.Close()
+	}
+
+	// Live logs and worker status.
+	if addr := abstractions.GetString(keys.StatusAddr); addr != "" {
+		if err := monitor.Start(ctx, addr); err != nil {
+			logger.Pl.E("%v", err)
 		}
-	}()
+	}
 
-	// Ensure log POST on main() exit.
-	defer logger.SendLogs()
+	// Live FFmpeg progress display.
+	if !abstractions.GetBool(keys.NoProgress) && !abstractions.GetBool(keys.SkipVideos) {
+		go progress.Stderr.Run(ctx)
+	}
 
 	// Initialize cached variables.
 	if err := file.InitFetchFilesVars(); err != nil {
 		logger.Pl.E("Failed to initialize variables to fetch files. Exiting...")
 		cancel()
+		exitCode = exitError
 		return
 	}
 
+	// Recover videos from swaps interrupted by a crash.
+	if !plan.Enabled() {
+		if err := file.RecoverSwaps(); err != nil {
+			logger.Pl.E("Failed to recover interrupted swaps: %v", err)
+		}
+
+		// Then leftover temp files, before any worker starts (server jobs recover their own directories).
+		if !abstractions.GetBool(keys.ServeMode) {
+			if err := processing.RecoverTempFiles(); err != nil {
+				logger.Pl.E("Failed to recover leftover temp files: %v", err)
+			}
+		}
+	}
+
+	// Load state from previous runs.
+	if err := state.Load(); err != nil {
+		logger.Pl.E("Failed to load state, all files will be processed: %v", err)
+	}
+
 	// Initialize user input reader (used for prompting the user during program run).
 	prompt.InitUserInputReader()
 
+	switch {
+	case abstractions.GetBool(keys.ServeMode):
+		// Run jobs submitted over HTTP until stopped, all on the same workers.
+		pipe := processing.StartPipeline(abstractions.GetInt(keys.MetaConcurrency), abstractions.GetInt(keys.Concurrency))
+		run := func(ctx context.Context, options map[string]any) (api.Result, error) {
+			return runJob(ctx, pipe, options)
+		}
+		if err := api.Serve(ctx, abstractions.GetString(keys.ServeAddr), abstractions.GetString(keys.ServeToken), cfg.CheckJobOptions, run); err != nil {
+			logger.Pl.E("Job API failed: %v", err)
+			exitCode = exitTotalFailure
+		}
+		pipe.Stop()
+	case abstractions.GetBool(keys.WatchMode):
+		// Keep processing new files until stopped.
+		dirs, err := processing.WatchDirs()
+		if err != nil {
+			logger.Pl.E("Failed to get directories to watch: %v", err)
+			cancel()
+			exitCode = exitTotalFailure
+			return
+		}
+		pass := func(ctx context.Context) { _, _ = runPass(ctx, nil) }
+		if err := watch.Run(ctx, dirs, abstractions.GetDuration(keys.WatchSettle), pass); err != nil {
+			logger.Pl.E("Watch mode failed: %v", err)
+			exitCode = exitTotalFailure
+		}
+	default:
+		_, err := runPass(ctx, nil)
+		switch {
+		case errors.Is(err, errPartialFailure):
+			exitCode = exitPartialFailure
+		case err != nil:
+			exitCode = exitTotalFailure
+		}
+	}
+
+	// Output the dry-run plan.
+	if plan.Enabled() {
+		if err := plan.Write(os.Stdout); err != nil {
+			logger.Pl.E("Failed to write dry-run plan: %v", err)
+		}
+	}
+
+	// Check if shutdown was triggered by signal.
+	select {
+	case <-ctx.Done():
+		logger.Pl.I("Shutdown was triggered by signal")
+	default:
+	}
+
+	// End program run.
+	endTime := time.Now()
+	fmt.Fprintf(os.Stderr, "\n")
+	logger.Pl.I(endLogFormat, endTime.Format(timeFormat))
+	logger.Pl.I(elapsedFormat, endTime.Sub(startTime).Seconds())
+}
+
+// runJob applies a server job's options, then processes its batches on the server's pipeline.
+func runJob(ctx context.Context, pipe *processing.Pipeline, options map[string]any) (api.Result, error) {
+	if err := cfg.ApplyJobOptions(options); err != nil {
+		return api.Result{}, err
+	}
+	defer cfg.EndJob()
+	if err := file.InitFetchFilesVars(); err != nil {
+		return api.Result{}, fmt.Errorf("failed to initialize variables to fetch files: %w", err)
+	}
+	if err := state.Load(); err != nil {
+		logger.Pl.E("Failed to load state, all files will be processed: %v", err)
+	}
+	plan.Reset()
+	if !plan.Enabled() {
+		if err := processing.RecoverTempFiles(); err != nil {
+			logger.Pl.E("Failed to recover leftover temp files: %v", err)
+		}
+	}
+
+	runID, err := runPass(ctx, pipe)
+	res := api.Result{RunID: runID}
+	if plan.Enabled() {
+		var buf bytes.Buffer
+		if err := plan.Write(&buf); err != nil {
+			logger.Pl.E("Failed to write dry-run plan: %v", err)
+		}
+		res.Plan = buf.Bytes()
+	}
+	return res, err
+}
+
+// runPass processes all batches once, then renames the files and stores their state.
+//
+// Each pass has its own undo journal, whose ID is returned. Files are processed on 'pipe', or on a
+// pipeline of the pass's own if it's nil.
+func runPass(ctx context.Context, pipe *processing.Pipeline) (runID string, err error) {
+	// Journal filesystem changes so the run can be undone.
+	if !plan.Enabled() {
+		runID, err = journal.Start()
+		if err != nil {
+			logger.Pl.E("Failed to start undo journal, skipping run: %v", err)
+			return "", fmt.Errorf("failed to start undo journal: %w", err)
+		}
+		logger.Pl.I("Run ID: %s (reverse with 'metarr undo %s')", runID, runID)
+		defer func() {
+			if err := journal.Close(); err != nil {
+				logger.Pl.E("Failed to close undo journal: %v", err)
+			}
+		}()
+	}
+
+	events.SetRun(runID)
+	events.Publish(events.Event{Type: events.RunStarted})
+	defer func() {
+		ev := events.Event{Type: events.RunFinished}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		events.Publish(ev)
+		events.SetRun("")
+	}()
+
+	// Report every pair's outcome once the pass is done.
+	if report.Enabled() {
+		report.Start()
+		defer func() {
+			if path, writeErr := report.Finish(runID, err); writeErr != nil {
+				logger.Pl.E("Failed to write run report: %v", writeErr)
+			} else {
+				logger.Pl.I("Saved run report to %q", path)
+			}
+		}()
+	}
+
+	// Collect this pass's errors for its summary and outcome.
+	vars.ResetErrors()
+	completed := 0
+	defer func() {
+		if err == nil {
+			err = outcome(completed)
+		}
+		logErrorSummary()
+	}()
+
 	// Process batches.
 	wg := new(sync.WaitGroup)
 	core := &models.Core{
@@ -127,39 +321,76 @@ func main() {
 		Wg:  wg,
 	}
 
-	fdArray := []*models.FileData{}
-	fdArrayResult, err := processing.ProcessBatches(core)
+	fdArray, err := processing.ProcessBatches(core, pipe)
 	if err != nil {
 		logger.Pl.E("error during batch loop: %v", err)
-		cancel()
 		wg.Wait()
-		return
+		return runID, err
 	}
-	fdArray = append(fdArray, fdArrayResult...)
 
 	// Wait for all goroutines to finish.
 	wg.Wait()
 
-	// Process renames.
+	// Files are renamed and moved as each finishes, store state for those completed without failures.
 	if len(fdArray) > 0 {
-		logger.Pl.I("Processing file renames for %d file(s)...", len(fdArray))
-
-		if err := transformations.RenameFiles(ctx, fdArray); err != nil {
-			logger.Pl.E("Error during file renaming: %v", err)
+		for _, fd := range fdArray {
+			if fd == nil || fd.Failed || (fd.FinalVideoPath == "" && fd.FinalMetaPath == "") {
+				continue
+			}
+			completed++
+			if !plan.Enabled() {
+				state.Record(fd)
+			}
+		}
+		if !plan.Enabled() {
+			if err := state.Save(); err != nil {
+				logger.Pl.E("Failed to save state: %v", err)
+			}
 		}
-		logger.Pl.S("File renaming complete!")
 	}
+	return runID, nil
+}
 
-	// Check if shutdown was triggered by signal.
-	select {
-	case <-ctx.Done():
-		logger.Pl.I("Shutdown was triggered by signal")
+// outcome returns the pass's result from the errors collected and the number of pairs completed.
+func outcome(completed int) error {
+	n := len(vars.GetErrors())
+	switch {
+	case n == 0:
+		return nil
+	case completed == 0:
+		return fmt.Errorf("%w (%d error(s))", errTotalFailure, n)
 	default:
+		return fmt.Errorf("%w (%d error(s), %d file(s) completed)", errPartialFailure, n, completed)
+	}
+}
+
+// logErrorSummary logs the pass's collected errors grouped by kind.
+func logErrorSummary() {
+	errs := vars.GetErrors()
+	if len(errs) == 0 {
+		return
+	}
+
+	byKind := make(map[vars.ErrorKind][]vars.RunError)
+	for _, e := range errs {
+		byKind[e.Kind] = append(byKind[e.Kind], e)
 	}
 
-	// End program run.
-	endTime := time.Now()
 	fmt.Fprintf(os.Stderr, "\n")
-	logger.Pl.I(endLogFormat, endTime.Format(timeFormat))
-	logger.Pl.I(elapsedFormat, endTime.Sub(startTime).Seconds())
+	logger.Pl.E("Finished with %d error(s):", len(errs))
+	for _, kind := range vars.ErrorKinds {
+		group := byKind[kind]
+		if len(group) == 0 {
+			continue
+		}
+		logger.Pl.P("%s (%d):", kind, len(group))
+		for _, e := range group {
+			if e.File != "" {
+				logger.Pl.P("  %q: %v", e.File, e.Err)
+			} else {
+				logger.Pl.P("  %v", e.Err)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\n")
 }
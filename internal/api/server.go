@@ -0,0 +1,484 @@
+// Package api serves the local HTTP job API used by orchestrators such as Tubarr.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/domain/logger"
+	"metarr/internal/events"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job statuses.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusFinished  = "finished"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// File statuses.
+const (
+	FileProcessing = "processing"
+	FileFinished   = "finished"
+	FileFailed     = "failed"
+)
+
+// shutdownTimeout is how long open requests get to finish when the server stops.
+const shutdownTimeout = 5 * time.Second
+
+// keepFinishedJobs is how many finished jobs are kept in the history, older ones are forgotten.
+const keepFinishedJobs = 100
+
+// Result is the outcome of a job run.
+type Result struct {
+	RunID string          // Undo journal ID (empty in dry runs).
+	Plan  json.RawMessage // Dry-run plan, if the job was a dry run.
+}
+
+// Runner applies a job's options and processes its batches.
+type Runner func(ctx context.Context, options map[string]any) (Result, error)
+
+// Checker returns an error if a job's options are invalid.
+type Checker func(options map[string]any) error
+
+// FileStatus is the state of a file pair in a job.
+type FileStatus struct {
+	Video      string `json:"video,omitempty"`
+	Meta       string `json:"meta,omitempty"`
+	Status     string `json:"status"`
+	FinalVideo string `json:"final_video,omitempty"`
+	FinalMeta  string `json:"final_meta,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Job is a submitted processing job.
+type Job struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	Options  map[string]any  `json:"options"`
+	RunID    string          `json:"run_id,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Files    []*FileStatus   `json:"files"`
+	Plan     json.RawMessage `json:"dry_run_plan,omitempty"`
+
+	files  map[string]*FileStatus // Keyed by video path (metafile path for metafile-only jobs).
+	cancel context.CancelFunc
+}
+
+// server holds the job queue and history.
+type server struct {
+	ctx   context.Context
+	check Checker
+	run   Runner
+	token string
+
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*Job
+	order  []*Job
+	queue  []*Job
+	wake   chan struct{}
+}
+
+// Serve runs the job API on addr until the context is cancelled.
+//
+// Jobs run one at a time in submission order. If token is set, requests must carry it as a bearer token.
+func Serve(ctx context.Context, addr, token string, check Checker, run Runner) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	s := &server{
+		ctx:   ctx,
+		check: check,
+		run:   run,
+		token: token,
+		jobs:  make(map[string]*Job),
+		wake:  make(chan struct{}, 1),
+	}
+	events.AddHandler(s.handleEvent)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.submitJob)
+	mux.HandleFunc("GET /jobs", s.listJobs)
+	mux.HandleFunc("GET /jobs/{id}", s.getJob)
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.cancelJob)
+	mux.HandleFunc("GET /jobs/{id}/events", s.streamEvents)
+	mux.HandleFunc("GET /events", s.streamEvents)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.authorize(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		s.worker()
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	logger.Pl.I("Job API listening on http://%s", addr)
+
+	select {
+	case err := <-errCh:
+		stop()
+		<-workerDone
+		return fmt.Errorf("job API server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Let the running job wind down, so it isn't still using the workers when they stop.
+	<-workerDone
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("failed to stop job API server: %w", err)
+	}
+	logger.Pl.I("Job API stopped")
+	return nil
+}
+
+// authorize rejects requests without the bearer token, if one is set.
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// worker runs queued jobs until the server stops.
+func (s *server) worker() {
+	for {
+		job := s.next()
+		if job == nil {
+			return
+		}
+
+		jobCtx, cancel := context.WithCancel(s.ctx)
+		s.mu.Lock()
+		now := time.Now()
+		job.Status = StatusRunning
+		job.Started = &now
+		job.cancel = cancel
+		s.mu.Unlock()
+
+		events.SetJob(job.ID)
+		events.Publish(events.Event{Type: events.JobStarted})
+		logger.Pl.I("Starting job %s", job.ID)
+
+		res, err := s.run(jobCtx, job.Options)
+		cancelled := jobCtx.Err() != nil
+		cancel()
+
+		s.mu.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		job.RunID = res.RunID
+		job.Plan = res.Plan
+		ev := events.Event{Type: events.JobFinished}
+		switch {
+		case cancelled:
+			job.Status = StatusCancelled
+			ev.Type = events.JobCancelled
+		case err != nil:
+			job.Status = StatusFailed
+			job.Error = err.Error()
+			ev.Type, ev.Error = events.JobFailed, job.Error
+		default:
+			job.Status = StatusFinished
+		}
+		status := job.Status
+		s.pruneHistory()
+		s.mu.Unlock()
+
+		events.Publish(ev)
+		events.SetJob("")
+		logger.Pl.I("Job %s %s", job.ID, status)
+	}
+}
+
+// pruneHistory forgets the oldest finished jobs beyond keepFinishedJobs. Must be called under lock.
+func (s *server) pruneHistory() {
+	finished := 0
+	for _, job := range s.order {
+		if job.Finished != nil {
+			finished++
+		}
+	}
+	if finished <= keepFinishedJobs {
+		return
+	}
+
+	kept := s.order[:0]
+	for _, job := range s.order {
+		if job.Finished != nil && finished > keepFinishedJobs {
+			delete(s.jobs, job.ID)
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	clear(s.order[len(kept):])
+	s.order = kept
+}
+
+// next waits for the next queued job, returning nil once the server stops.
+func (s *server) next() *Job {
+	for {
+		if s.ctx.Err() != nil {
+			return nil
+		}
+		s.mu.Lock()
+		for len(s.queue) > 0 {
+			job := s.queue[0]
+			s.queue = s.queue[1:]
+			if job.Status == StatusQueued {
+				s.mu.Unlock()
+				return job
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-s.wake:
+		}
+	}
+}
+
+// handleEvent updates the running job's file statuses.
+func (s *server) handleEvent(e events.Event) {
+	switch e.Type {
+	case events.FileStarted, events.FileFinished, events.FileFailed:
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[e.Job]
+	if !ok {
+		return
+	}
+	key := e.Video
+	if key == "" {
+		key = e.Meta
+	}
+	f, ok := job.files[key]
+	if !ok {
+		f = &FileStatus{Video: e.Video, Meta: e.Meta}
+		job.files[key] = f
+		job.Files = append(job.Files, f)
+	}
+
+	switch e.Type {
+	case events.FileStarted:
+		f.Status = FileProcessing
+	case events.FileFinished:
+		f.Status = FileFinished
+		f.FinalVideo, f.FinalMeta = e.FinalVideo, e.FinalMeta
+	case events.FileFailed:
+		f.Status = FileFailed
+		f.Error = e.Error
+	}
+}
+
+// submitJob queues a new job.
+func (s *server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Options map[string]any `json:"options"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+		return
+	}
+	if req.Options == nil {
+		req.Options = make(map[string]any)
+	}
+	if err := s.check(req.Options); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	job := &Job{
+		ID:      fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), s.nextID),
+		Status:  StatusQueued,
+		Options: req.Options,
+		Created: time.Now(),
+		Files:   []*FileStatus{},
+		files:   make(map[string]*FileStatus),
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job)
+	s.queue = append(s.queue, job)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	events.Publish(events.Event{Type: events.JobQueued, Job: job.ID})
+
+	s.writeJobs(w, http.StatusAccepted, job)
+}
+
+// listJobs returns every job, oldest first.
+func (s *server) listJobs(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	jobs := make([]*Job, len(s.order))
+	copy(jobs, s.order)
+	s.mu.Unlock()
+
+	s.writeJobs(w, http.StatusOK, jobs)
+}
+
+// getJob returns a job with its file statuses.
+func (s *server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	s.writeJobs(w, http.StatusOK, job)
+}
+
+// cancelJob removes a queued job, or stops a running one.
+func (s *server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	var publish bool
+	switch job.Status {
+	case StatusQueued:
+		now := time.Now()
+		job.Status = StatusCancelled
+		job.Finished = &now
+		publish = true
+		s.pruneHistory()
+	case StatusRunning:
+		job.cancel()
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s already %s", job.ID, job.Status))
+		return
+	}
+	s.mu.Unlock()
+
+	if publish {
+		events.Publish(events.Event{Type: events.JobCancelled, Job: job.ID})
+	}
+	s.writeJobs(w, http.StatusAccepted, job)
+}
+
+// streamEvents sends events as Server-Sent Events, filtered to one job for '/jobs/{id}/events'.
+func (s *server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	var jobID string
+	if r.PathValue("id") != "" {
+		job, ok := s.lookup(w, r)
+		if !ok {
+			return
+		}
+		jobID = job.ID
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	ch, unsubscribe := events.Subscribe(256)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if jobID != "" && e.Job != jobID {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				logger.Pl.E("Failed to encode event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// lookup returns the job named in the request path, writing a 404 if there is none.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job with ID %q", r.PathValue("id")))
+	}
+	return job, ok
+}
+
+// writeJobs encodes one or more jobs as JSON, holding the lock so they can't change while being written.
+func (s *server) writeJobs(w http.ResponseWriter, status int, v any) {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(v, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+// writeError sends a JSON error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPruneHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		finished int // Finished jobs, oldest first.
+		active   int // Running or queued jobs after them.
+		wantKept int // Finished jobs kept.
+	}{
+		{"under the limit", keepFinishedJobs - 1, 1, keepFinishedJobs - 1},
+		{"at the limit", keepFinishedJobs, 0, keepFinishedJobs},
+		{"over the limit", keepFinishedJobs + 5, 2, keepFinishedJobs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{jobs: make(map[string]*Job)}
+			now := time.Now()
+			for i := range tt.finished + tt.active {
+				job := &Job{ID: strconv.Itoa(i), Status: StatusQueued}
+				if i < tt.finished {
+					job.Status, job.Finished = StatusFinished, &now
+				}
+				s.jobs[job.ID] = job
+				s.order = append(s.order, job)
+			}
+
+			s.pruneHistory()
+
+			if got := len(s.order); got != tt.wantKept+tt.active {
+				t.Fatalf("kept %d jobs, want %d", got, tt.wantKept+tt.active)
+			}
+			if len(s.jobs) != len(s.order) {
+				t.Errorf("%d jobs by ID, %d in order", len(s.jobs), len(s.order))
+			}
+			// The newest finished jobs are kept, in order.
+			if first := s.order[0].ID; first != strconv.Itoa(tt.finished-tt.wantKept) {
+				t.Errorf("oldest kept job is %s, want %d", first, tt.finished-tt.wantKept)
+			}
+			for _, job := range s.order[tt.wantKept:] {
+				if job.Finished != nil {
+					t.Errorf("job %s out of order", job.ID)
+				}
+			}
+		})
+	}
+}
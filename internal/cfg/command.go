@@ -2,11 +2,14 @@
 package cfg
 
 import (
+	"errors"
 	"fmt"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/paths"
 	"metarr/internal/domain/vars"
+	"metarr/internal/file"
+	"metarr/internal/journal"
 	"os"
 
 	"github.com/TubarrApp/gocommon/benchmark"
@@ -48,7 +51,7 @@ var rootCmd = &cobra.Command{
 
 			// Load in config file.
 			if configFile != "" {
-				if err := loadConfigFile(configFile); err != nil {
+				if err := loadConfigFile(viper.GetViper(), configFile); err != nil {
 					fmt.Fprintf(os.Stderr, "failed loading config file: %v\n", err)
 					os.Exit(1)
 				}
@@ -64,6 +67,74 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// undoCmd reverses the filesystem changes made by a previous run.
+var undoCmd = &cobra.Command{
+	Use:   "undo [run-id|latest]",
+	Short: "Reverse the file renames, moves, purges, and metafile edits made by a previous run.",
+	Long:  "Replays a run's journal in reverse to restore file paths and metafile contents. Run without arguments to list runs which can be undone.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		ids, err := journal.List()
+		if err != nil {
+			return err
+		}
+
+		// List runs.
+		if len(args) == 0 {
+			if len(ids) == 0 {
+				fmt.Fprintln(os.Stderr, "No runs to undo.")
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, "Runs which can be undone (oldest first):")
+			for _, id := range ids {
+				fmt.Fprintf(os.Stdout, "%s\n", id)
+			}
+			return nil
+		}
+
+		id := args[0]
+		if id == "latest" {
+			if len(ids) == 0 {
+				return errors.New("no runs to undo")
+			}
+			id = ids[len(ids)-1]
+		}
+		return file.UndoRun(id)
+	},
+}
+
+// watchCmd runs Metarr as a daemon, processing files in the batch directories as they finish downloading.
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch the input directories and process new files once they finish downloading.",
+	Long:  "Processes the configured batches, then keeps watching their directories. New files are processed once unchanged for --watch-settle, and pairs with unfinished downloads (e.g. '.part' files) are held back.",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if viper.GetBool(keys.DryRun) {
+			return errors.New("watch mode cannot be combined with --dry-run")
+		}
+		if viper.GetDuration(keys.WatchSettle) <= 0 {
+			return fmt.Errorf("--%s must be above zero", keys.WatchSettle)
+		}
+		viper.Set(keys.WatchMode, true)
+		viper.Set("execute", true)
+		return execute()
+	},
+}
+
+// serveCmd runs Metarr as a local HTTP job server.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a local HTTP API which accepts, tracks, and cancels processing jobs.",
+	Long:  "Starts a job API on --serve-addr. Each job takes the same options as the command line flags (as JSON) on top of the flags the server was started with. Jobs run one at a time in submission order.",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		viper.Set(keys.ServeMode, true)
+		viper.Set("execute", true)
+		return execute()
+	},
+}
+
 // Execute is the primary initializer of Viper.
 func Execute() error {
 	fmt.Fprintf(os.Stderr, "\n")
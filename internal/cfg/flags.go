@@ -5,6 +5,7 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -50,10 +51,14 @@ func initFilesDirs() error {
 // initResourceRelated initializes user flag settings for parameters related to system hardware.
 func initResourceRelated() error {
 	// Concurrency limit.
-	rootCmd.PersistentFlags().IntP(keys.Concurrency, "l", 5, "Max concurrency limit")
+	rootCmd.PersistentFlags().IntP(keys.Concurrency, "l", 5, "Max concurrency limit (videos processed at once)")
 	if err := viper.BindPFlag(keys.Concurrency, rootCmd.PersistentFlags().Lookup(keys.Concurrency)); err != nil {
 		return err
 	}
+	rootCmd.PersistentFlags().Int(keys.MetaConcurrency, 4, "Max metafiles processed at once, including web scraping")
+	if err := viper.BindPFlag(keys.MetaConcurrency, rootCmd.PersistentFlags().Lookup(keys.MetaConcurrency)); err != nil {
+		return err
+	}
 
 	// CPU usage.
 	rootCmd.PersistentFlags().Float64P(keys.MaxCPU, "c", 101.0, "Max CPU usage %")
@@ -105,6 +110,12 @@ func initMetaTransformers() error {
 		return err
 	}
 
+	// Filename patterns
+	rootCmd.PersistentFlags().StringSlice(keys.FilenamePatterns, nil, "Patterns to pull missing metadata from filenames, tried in order (e.g. '{uploader} - {title} [{id}]', or a regex with named groups)")
+	if err := viper.BindPFlag(keys.FilenamePatterns, rootCmd.PersistentFlags().Lookup(keys.FilenamePatterns)); err != nil {
+		return err
+	}
+
 	// Overwrite or preserve metafields
 	rootCmd.PersistentFlags().Bool(keys.MOverwrite, false, "When adding new metadata fields, automatically overwrite existing fields with your new values")
 	if err := viper.BindPFlag(keys.MOverwrite, rootCmd.PersistentFlags().Lookup(keys.MOverwrite)); err != nil {
@@ -116,6 +127,12 @@ func initMetaTransformers() error {
 		return err
 	}
 
+	// Stub metafiles for videos without one
+	rootCmd.PersistentFlags().Bool(keys.StubMetadata, false, "Create a JSON metafile for videos with no matching metafile, using the video's container tags, filename date and timestamps")
+	if err := viper.BindPFlag(keys.StubMetadata, rootCmd.PersistentFlags().Lookup(keys.StubMetadata)); err != nil {
+		return err
+	}
+
 	rootCmd.PersistentFlags().String(keys.MetaPurge, "", "Delete metadata files (e.g. .json, .nfo) after the video is successfully processed")
 	if err := viper.BindPFlag(keys.MetaPurge, rootCmd.PersistentFlags().Lookup(keys.MetaPurge)); err != nil {
 		return err
@@ -185,6 +202,64 @@ func initVideoTransformers() error {
 		return err
 	}
 
+	rootCmd.PersistentFlags().String(keys.ThumbnailSidecars, "keep", "What to do with a local thumbnail image after embedding: 'keep', 'delete', or 'kodi' (keep as '<video>-thumb.jpg')")
+	if err := viper.BindPFlag(keys.ThumbnailSidecars, rootCmd.PersistentFlags().Lookup(keys.ThumbnailSidecars)); err != nil {
+		return err
+	}
+
+	// Output verification.
+	rootCmd.PersistentFlags().Bool(keys.VerifyOutput, true, "Probe FFmpeg output and compare it with the input before replacing the original")
+	if err := viper.BindPFlag(keys.VerifyOutput, rootCmd.PersistentFlags().Lookup(keys.VerifyOutput)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().Bool(keys.VerifyDecode, false, "Also fully decode FFmpeg output to check for errors (slow)")
+	if err := viper.BindPFlag(keys.VerifyDecode, rootCmd.PersistentFlags().Lookup(keys.VerifyDecode)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().Float64(keys.VerifyDurationTolerance, 1.0, "Allowed duration difference in seconds between input and FFmpeg output")
+	if err := viper.BindPFlag(keys.VerifyDurationTolerance, rootCmd.PersistentFlags().Lookup(keys.VerifyDurationTolerance)); err != nil {
+		return err
+	}
+
+	// Stream selection.
+	rootCmd.PersistentFlags().StringSlice(keys.AudioLanguages, nil, "Only keep audio streams with these language tags (e.g. 'eng,jpn', 'und' for untagged)")
+	if err := viper.BindPFlag(keys.AudioLanguages, rootCmd.PersistentFlags().Lookup(keys.AudioLanguages)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().StringSlice(keys.SubtitleLanguages, nil, "Only keep subtitle streams with these language tags (e.g. 'eng', 'und' for untagged)")
+	if err := viper.BindPFlag(keys.SubtitleLanguages, rootCmd.PersistentFlags().Lookup(keys.SubtitleLanguages)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().StringSlice(keys.DropStreamTypes, nil, "Drop all streams of these types (audio, subtitle, data, attachment)")
+	if err := viper.BindPFlag(keys.DropStreamTypes, rootCmd.PersistentFlags().Lookup(keys.DropStreamTypes)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().StringSlice(keys.DropDispositions, nil, "Drop audio and subtitle streams with these dispositions (commentary, hearing_impaired, visual_impaired, forced, default)")
+	if err := viper.BindPFlag(keys.DropDispositions, rootCmd.PersistentFlags().Lookup(keys.DropDispositions)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().Bool(keys.ForcedSubtitlesOnly, false, "Only keep subtitle streams flagged as forced")
+	if err := viper.BindPFlag(keys.ForcedSubtitlesOnly, rootCmd.PersistentFlags().Lookup(keys.ForcedSubtitlesOnly)); err != nil {
+		return err
+	}
+
+	// Subtitle sidecars.
+	rootCmd.PersistentFlags().Bool(keys.MuxSubtitles, false, "Mux subtitle files beside the video (e.g. 'Title.en.vtt', 'Title.en-orig.srt') into the output")
+	if err := viper.BindPFlag(keys.MuxSubtitles, rootCmd.PersistentFlags().Lookup(keys.MuxSubtitles)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().String(keys.SubtitleSidecars, "keep", "What to do with subtitle files after muxing: 'keep', 'delete', or 'move:<dir>' (relative to the video directory)")
+	if err := viper.BindPFlag(keys.SubtitleSidecars, rootCmd.PersistentFlags().Lookup(keys.SubtitleSidecars)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -222,6 +297,38 @@ func initFiltering() error {
 	if err := viper.BindPFlag(keys.FileOmits, rootCmd.PersistentFlags().Lookup(keys.FileOmits)); err != nil {
 		return err
 	}
+
+	// Directory recursion.
+	rootCmd.PersistentFlags().Int(keys.MaxDepth, -1, "Max subdirectory depth to search in input directories (-1 for unlimited, 0 for top level only)")
+	if err := viper.BindPFlag(keys.MaxDepth, rootCmd.PersistentFlags().Lookup(keys.MaxDepth)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().Bool(keys.FollowSymlinks, false, "Follow symlinked files and directories when searching input directories")
+	if err := viper.BindPFlag(keys.FollowSymlinks, rootCmd.PersistentFlags().Lookup(keys.FollowSymlinks)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().StringSlice(keys.ExcludeDirs, nil, "Glob patterns for subdirectories to skip (matched against directory name or relative path, e.g. 'extras', 'Season */Specials')")
+	if err := viper.BindPFlag(keys.ExcludeDirs, rootCmd.PersistentFlags().Lookup(keys.ExcludeDirs)); err != nil {
+		return err
+	}
+
+	// Video and metafile pairing.
+	rootCmd.PersistentFlags().StringSlice(keys.MatchStrategies, []string{"exact"}, "Strategies for pairing videos with metafiles, tried in order (exact, tag-id, json-id, fuzzy)")
+	if err := viper.BindPFlag(keys.MatchStrategies, rootCmd.PersistentFlags().Lookup(keys.MatchStrategies)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().Float64(keys.MatchThreshold, 0.9, "Minimum name similarity (0-1) for the fuzzy pairing strategy")
+	if err := viper.BindPFlag(keys.MatchThreshold, rootCmd.PersistentFlags().Lookup(keys.MatchThreshold)); err != nil {
+		return err
+	}
+
+	rootCmd.PersistentFlags().String(keys.QuarantineDir, "", "Move metafiles with no matching video into this directory (relative paths are inside the metadata directory)")
+	if err := viper.BindPFlag(keys.QuarantineDir, rootCmd.PersistentFlags().Lookup(keys.QuarantineDir)); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -239,6 +346,62 @@ func initProgramFunctions() error {
 		return err
 	}
 
+	// Live FFmpeg progress display.
+	rootCmd.PersistentFlags().Bool(keys.NoProgress, false, "Don't display live FFmpeg progress in the terminal")
+	if err := viper.BindPFlag(keys.NoProgress, rootCmd.PersistentFlags().Lookup(keys.NoProgress)); err != nil {
+		return err
+	}
+
+	// Dry run.
+	rootCmd.PersistentFlags().Bool(keys.DryRun, false, "Print a JSON plan of all intended changes without writing anything")
+	if err := viper.BindPFlag(keys.DryRun, rootCmd.PersistentFlags().Lookup(keys.DryRun)); err != nil {
+		return err
+	}
+
+	// Watch mode settle time.
+	rootCmd.PersistentFlags().Duration(keys.WatchSettle, 10*time.Second, "In watch mode, how long a file must go unchanged before it is processed")
+	if err := viper.BindPFlag(keys.WatchSettle, rootCmd.PersistentFlags().Lookup(keys.WatchSettle)); err != nil {
+		return err
+	}
+
+	// Job API server.
+	rootCmd.PersistentFlags().String(keys.ServeAddr, "127.0.0.1:8828", "In server mode, the address for the job API to listen on")
+	if err := viper.BindPFlag(keys.ServeAddr, rootCmd.PersistentFlags().Lookup(keys.ServeAddr)); err != nil {
+		return err
+	}
+	rootCmd.PersistentFlags().String(keys.ServeToken, "", "In server mode, require this bearer token on job API requests")
+	if err := viper.BindPFlag(keys.ServeToken, rootCmd.PersistentFlags().Lookup(keys.ServeToken)); err != nil {
+		return err
+	}
+
+	// Event push.
+	rootCmd.PersistentFlags().String(keys.EventsURL, "", "POST structured JSON events (run, file, FFmpeg progress, errors) to this URL, e.g. Tubarr")
+	if err := viper.BindPFlag(keys.EventsURL, rootCmd.PersistentFlags().Lookup(keys.EventsURL)); err != nil {
+		return err
+	}
+	rootCmd.PersistentFlags().String(keys.EventsToken, "", "Bearer token sent with pushed events")
+	if err := viper.BindPFlag(keys.EventsToken, rootCmd.PersistentFlags().Lookup(keys.EventsToken)); err != nil {
+		return err
+	}
+
+	// Live logs and worker status.
+	rootCmd.PersistentFlags().String(keys.StatusAddr, "", "Serve live logs and worker status over HTTP on this address (e.g. 127.0.0.1:6387)")
+	if err := viper.BindPFlag(keys.StatusAddr, rootCmd.PersistentFlags().Lookup(keys.StatusAddr)); err != nil {
+		return err
+	}
+
+	// Run report.
+	rootCmd.PersistentFlags().String(keys.Report, "", "Write a JSON report of each run to this file (a .jsonl file gets one line appended per run)")
+	if err := viper.BindPFlag(keys.Report, rootCmd.PersistentFlags().Lookup(keys.Report)); err != nil {
+		return err
+	}
+
+	// Ignore stored state from previous runs.
+	rootCmd.PersistentFlags().Bool(keys.IgnoreState, false, "Process all files, even those unchanged since the last successful run")
+	if err := viper.BindPFlag(keys.IgnoreState, rootCmd.PersistentFlags().Lookup(keys.IgnoreState)); err != nil {
+		return err
+	}
+
 	// Output benchmarking files.
 	rootCmd.PersistentFlags().Bool(keys.Benchmarking, false, "Benchmarks the program")
 	if err := viper.BindPFlag(keys.Benchmarking, rootCmd.PersistentFlags().Lookup(keys.Benchmarking)); err != nil {
@@ -256,10 +419,10 @@ func initOrExit(err error, failMsg string) {
 }
 
 // loadConfigFile loads in the preset configuration file.
-func loadConfigFile(file string) error {
+func loadConfigFile(v *viper.Viper, file string) error {
 	logger.Pl.I("Using configuration file %q", file)
-	viper.SetConfigFile(file)
-	if err := viper.ReadInConfig(); err != nil {
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
 		return err
 	}
 
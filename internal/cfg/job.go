@@ -0,0 +1,75 @@
+package cfg
+
+import (
+	"fmt"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ApplyJobOptions makes the server's flags plus the job's options the settings in use, until EndJob.
+//
+// The job gets its own configuration, so the server's settings are left untouched. Jobs run one at a
+// time, as the settings in use are shared by the whole program.
+// Options use the same names as the command line flags (e.g. "meta-ops", "video-directory").
+func ApplyJobOptions(options map[string]any) error {
+	if err := CheckJobOptions(options); err != nil {
+		return err
+	}
+
+	v := viper.New()
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer("_", "-"))
+
+	var bindErr error
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if err := v.BindPFlag(f.Name, f); err != nil && bindErr == nil {
+			bindErr = err
+		}
+	})
+	if bindErr != nil {
+		return bindErr
+	}
+
+	for name, value := range options {
+		v.Set(name, value)
+	}
+	if configFile := v.GetString(keys.ConfigPath); configFile != "" {
+		if err := loadConfigFile(v, configFile); err != nil {
+			return fmt.Errorf("failed loading config file: %w", err)
+		}
+	}
+
+	abstractions.Use(v)
+	logging.Level = min(max(v.GetInt(keys.DebugLevel), 0), 5)
+	if err := execute(); err != nil {
+		EndJob()
+		return err
+	}
+	return nil
+}
+
+// EndJob restores the server's own settings after a job.
+func EndJob() {
+	abstractions.Use(nil)
+	logging.Level = min(max(viper.GetInt(keys.DebugLevel), 0), 5)
+}
+
+// CheckJobOptions returns an error if any option is not a flag which can be set per job.
+func CheckJobOptions(options map[string]any) error {
+	for name := range options {
+		if rootCmd.PersistentFlags().Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+		switch name {
+		case keys.ServeAddr, keys.ServeToken, keys.WatchSettle, keys.EventsURL, keys.EventsToken, keys.StatusAddr,
+			keys.Concurrency, keys.MetaConcurrency: // Workers are shared by all jobs.
+			return fmt.Errorf("option %q cannot be set per job", name)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cfg
 
 import (
 	"fmt"
+	"metarr/internal/abstractions"
 	"metarr/internal/domain/keys"
 	"metarr/internal/validation"
 	"os"
@@ -52,70 +53,99 @@ func init() {
 	// Special functions.
 	initOrExit(initProgramFunctions(),
 		"config program function initialization failure")
+
+	// Subcommands.
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(serveCmd)
 }
 
 // execute more thoroughly handles settings created in the Viper init.
 func execute() (err error) {
 	// Batch pairs.
-	if viper.IsSet(keys.BatchPairsInput) {
-		if err := validation.ValidateAndSetBatchPairs(viper.GetStringSlice(keys.BatchPairsInput)); err != nil {
+	if abstractions.IsSet(keys.BatchPairsInput) {
+		if err := validation.ValidateAndSetBatchPairs(abstractions.GetStringSlice(keys.BatchPairsInput)); err != nil {
 			return err
 		}
 	}
 
 	// Concurrency.
-	validation.ValidateAndSetConcurrencyLimit(viper.GetInt(keys.Concurrency))
+	validation.ValidateAndSetConcurrencyLimit(abstractions.GetInt(keys.Concurrency))
+	validation.ValidateAndSetMetaConcurrencyLimit(abstractions.GetInt(keys.MetaConcurrency))
 
 	// Resource usage limits (CPU and memory).
-	validation.ValidateAndSetMinFreeMem(viper.GetString(keys.MinFreeMem))
-	validation.ValidateAndSetMaxCPU(viper.GetFloat64(keys.MaxCPU))
+	validation.ValidateAndSetMinFreeMem(abstractions.GetString(keys.MinFreeMem))
+	validation.ValidateAndSetMaxCPU(abstractions.GetFloat64(keys.MaxCPU))
 
 	// File extension settings.
 	validation.ValidateAndSetInputFiletypes(
-		viper.GetStringSlice(keys.InputVideoExts),
-		viper.GetStringSlice(keys.InputMetaExts),
+		abstractions.GetStringSlice(keys.InputVideoExts),
+		abstractions.GetStringSlice(keys.InputMetaExts),
 	)
 
 	// File filter settings.
-	if viper.IsSet(keys.FilePrefixes) {
-		validation.ValidateAndSetFileFilters(keys.FilePrefixes, viper.GetStringSlice(keys.FilePrefixes))
+	if abstractions.IsSet(keys.FilePrefixes) {
+		validation.ValidateAndSetFileFilters(keys.FilePrefixes, abstractions.GetStringSlice(keys.FilePrefixes))
+	}
+	if abstractions.IsSet(keys.FileSuffixes) {
+		validation.ValidateAndSetFileFilters(keys.FileSuffixes, abstractions.GetStringSlice(keys.FileSuffixes))
+	}
+	if abstractions.IsSet(keys.FileContains) {
+		validation.ValidateAndSetFileFilters(keys.FileContains, abstractions.GetStringSlice(keys.FileContains))
+	}
+	if abstractions.IsSet(keys.FileOmits) {
+		validation.ValidateAndSetFileFilters(keys.FileOmits, abstractions.GetStringSlice(keys.FileOmits))
+	}
+
+	// Directory recursion settings.
+	validation.ValidateAndSetMaxDepth(abstractions.GetInt(keys.MaxDepth))
+	if abstractions.IsSet(keys.ExcludeDirs) {
+		if err := validation.ValidateAndSetExcludeDirs(abstractions.GetStringSlice(keys.ExcludeDirs)); err != nil {
+			return err
+		}
 	}
-	if viper.IsSet(keys.FileSuffixes) {
-		validation.ValidateAndSetFileFilters(keys.FileSuffixes, viper.GetStringSlice(keys.FileSuffixes))
+
+	// Pairing strategies.
+	if err := validation.ValidateAndSetMatchStrategies(abstractions.GetStringSlice(keys.MatchStrategies)); err != nil {
+		return err
 	}
-	if viper.IsSet(keys.FileContains) {
-		validation.ValidateAndSetFileFilters(keys.FileContains, viper.GetStringSlice(keys.FileContains))
+	if err := validation.ValidateAndSetMatchThreshold(abstractions.GetFloat64(keys.MatchThreshold)); err != nil {
+		return err
 	}
-	if viper.IsSet(keys.FileOmits) {
-		validation.ValidateAndSetFileFilters(keys.FileOmits, viper.GetStringSlice(keys.FileOmits))
+
+	// Event push endpoint.
+	if abstractions.GetString(keys.EventsURL) != "" {
+		if err := validation.ValidateAndSetEventsURL(abstractions.GetString(keys.EventsURL)); err != nil {
+			return err
+		}
 	}
 
 	// Output directory.
-	if viper.IsSet(keys.OutputDirectory) {
-		if _, _, err := sharedvalidation.ValidateDirectory(viper.GetString(keys.OutputDirectory), true, sharedtemplates.MetarrTemplateTags); err != nil {
+	if abstractions.IsSet(keys.OutputDirectory) {
+		if _, _, err := sharedvalidation.ValidateDirectory(abstractions.GetString(keys.OutputDirectory), true, sharedtemplates.MetarrTemplateTags); err != nil {
 			return err
 		}
 	}
 
 	// Filetype to output as.
-	if viper.IsSet(keys.OutputFiletype) {
-		validation.ValidateAndSetOutputFiletype(viper.GetString(keys.OutputFiletype))
+	if abstractions.IsSet(keys.OutputFiletype) {
+		validation.ValidateAndSetOutputFiletype(abstractions.GetString(keys.OutputFiletype))
 	}
 
 	// Meta overwrite and preserve flags.
 	validation.ValidateAndSetMetaOverwritePreserve(
-		viper.GetBool(keys.MOverwrite),
-		viper.GetBool(keys.MPreserve),
+		abstractions.GetBool(keys.MOverwrite),
+		abstractions.GetBool(keys.MPreserve),
 	)
 
 	// Verify user metafile purge settings.
-	if viper.IsSet(keys.MetaPurge) {
-		validation.ValidateAndSetPurgeMetafiles(viper.GetString(keys.MetaPurge))
+	if abstractions.IsSet(keys.MetaPurge) {
+		validation.ValidateAndSetPurgeMetafiles(abstractions.GetString(keys.MetaPurge))
 	}
 
 	// Parse and verify the audio codec.
-	if viper.IsSet(keys.TranscodeAudioCodecInput) {
-		if err := validation.ValidateAndSetAudioCodec(viper.GetStringSlice(keys.TranscodeAudioCodecInput)); err != nil {
+	if abstractions.IsSet(keys.TranscodeAudioCodecInput) {
+		if err := validation.ValidateAndSetAudioCodec(abstractions.GetStringSlice(keys.TranscodeAudioCodecInput)); err != nil {
 			return err
 		}
 	}
@@ -123,13 +153,13 @@ func execute() (err error) {
 	// Parse GPU settings and set commands.
 	// Retrieve Viper strings.
 	var accel string
-	if viper.IsSet(keys.TranscodeGPU) {
-		accel = viper.GetString(keys.TranscodeGPU)
+	if abstractions.IsSet(keys.TranscodeGPU) {
+		accel = abstractions.GetString(keys.TranscodeGPU)
 	}
 
 	nodePath := ""
-	if viper.IsSet(keys.TranscodeGPUNode) {
-		nodePath = viper.GetString(keys.TranscodeGPUNode)
+	if abstractions.IsSet(keys.TranscodeGPUNode) {
+		nodePath = abstractions.GetString(keys.TranscodeGPUNode)
 	}
 
 	// Validate GPU.
@@ -137,20 +167,37 @@ func execute() (err error) {
 		if a, err := validation.ValidateGPUAcceleration(accel, nodePath); err != nil {
 			return err
 		} else if a != accel {
-			viper.Set(keys.TranscodeGPU, a)
+			abstractions.Set(keys.TranscodeGPU, a)
 		}
 	}
 
-	if viper.IsSet(keys.TranscodeVideoCodecInput) {
-		if err := validation.ValidateAndSetVideoCodec(viper.GetStringSlice((keys.TranscodeVideoCodecInput))); err != nil {
+	if abstractions.IsSet(keys.TranscodeVideoCodecInput) {
+		if err := validation.ValidateAndSetVideoCodec(abstractions.GetStringSlice((keys.TranscodeVideoCodecInput))); err != nil {
 			return err
 		}
 	}
-	if viper.IsSet(keys.TranscodeQuality) {
-		if err := validation.ValidateAndSetTranscodeQuality(viper.GetString(keys.TranscodeQuality)); err != nil {
+	if abstractions.IsSet(keys.TranscodeQuality) {
+		if err := validation.ValidateAndSetTranscodeQuality(abstractions.GetString(keys.TranscodeQuality)); err != nil {
 			return err
 		}
 	}
+	validation.ValidateAndSetVerifyDurationTolerance(abstractions.GetFloat64(keys.VerifyDurationTolerance))
+
+	// Stream selection.
+	validation.ValidateAndSetLanguages(keys.AudioLanguages, abstractions.GetStringSlice(keys.AudioLanguages))
+	validation.ValidateAndSetLanguages(keys.SubtitleLanguages, abstractions.GetStringSlice(keys.SubtitleLanguages))
+	if err := validation.ValidateAndSetDropStreamTypes(abstractions.GetStringSlice(keys.DropStreamTypes)); err != nil {
+		return err
+	}
+	if err := validation.ValidateAndSetDropDispositions(abstractions.GetStringSlice(keys.DropDispositions)); err != nil {
+		return err
+	}
+	if err := validation.ValidateAndSetSubtitleSidecars(abstractions.GetString(keys.SubtitleSidecars)); err != nil {
+		return err
+	}
+	if err := validation.ValidateAndSetThumbnailSidecars(abstractions.GetString(keys.ThumbnailSidecars)); err != nil {
+		return err
+	}
 
 	// Get meta operations and other transformations.
 	if err := initTransformations(); err != nil {
@@ -162,18 +209,25 @@ func execute() (err error) {
 // initTransformations initializes text replacement flags.
 func initTransformations() error {
 	// Set rename flag.
-	validation.ValidateAndSetRenameFlag(viper.GetString(keys.RenameStyle))
+	validation.ValidateAndSetRenameFlag(abstractions.GetString(keys.RenameStyle))
 
 	// Validate filename operations.
-	if viper.IsSet(keys.FilenameOpsInput) {
-		if err := validation.ValidateAndSetFilenameOps(viper.GetStringSlice(keys.FilenameOpsInput)); err != nil {
+	if abstractions.IsSet(keys.FilenameOpsInput) {
+		if err := validation.ValidateAndSetFilenameOps(abstractions.GetStringSlice(keys.FilenameOpsInput)); err != nil {
+			return err
+		}
+	}
+
+	// Validate filename patterns.
+	if abstractions.IsSet(keys.FilenamePatterns) {
+		if err := validation.ValidateAndSetFilenamePatterns(abstractions.GetStringSlice(keys.FilenamePatterns)); err != nil {
 			return err
 		}
 	}
 
 	// Validate meta operations.
-	if viper.IsSet(keys.MetaOpsInput) {
-		if err := validation.ValidateAndSetMetaOps(viper.GetStringSlice(keys.MetaOpsInput)); err != nil {
+	if abstractions.IsSet(keys.MetaOpsInput) {
+		if err := validation.ValidateAndSetMetaOps(abstractions.GetStringSlice(keys.MetaOpsInput)); err != nil {
 			return err
 		}
 	}
@@ -13,6 +13,7 @@ const (
 const (
 	BackupTag = "_metarrbackup"
 	TempTag   = "tmp_"
+	SwapTag   = "_metarrswap"
 )
 
 // Bytes.
@@ -19,21 +19,33 @@ const (
 	FileSuffixes   string = "filter-suffix"
 	FileContains   string = "filter-contains"
 	FileOmits      string = "filter-omits"
+	MaxDepth       string = "max-depth"
+	FollowSymlinks string = "follow-symlinks"
+	ExcludeDirs    string = "exclude-dirs"
+
+	MatchStrategies string = "match-strategies"
+	MatchThreshold  string = "match-threshold"
+	QuarantineDir   string = "quarantine-dir"
 
 	Concurrency     string = "concurrency"
+	MetaConcurrency string = "meta-concurrency"
 	MaxCPU          string = "max-cpu"
 	MinFreeMemInput string = "min-free-mem"
 
 	FilenameOpsInput string = "filename-ops"
 	RenameStyle      string = "rename-style"
 
-	MetaOpsInput string = "meta-ops"
+	MetaOpsInput     string = "meta-ops"
+	FilenamePatterns string = "filename-patterns"
 
 	DebugLevel      string = "debug"
 	SkipVideos      string = "skip-videos"
 	NoFileOverwrite string = "no-file-overwrite"
 
 	Benchmarking    string = "benchmark"
+	IgnoreState     string = "ignore-state"
+	DryRun          string = "dry-run"
+	NoProgress      string = "no-progress"
 	OutputFiletype  string = "output-ext"
 	OutputDirectory string = "output-directory"
 
@@ -48,6 +60,31 @@ const (
 	ExtraFFmpegArgs      string = "extra-ffmpeg-args"
 	ForceWriteThumbnails string = "force-write-thumbnail"
 	StripThumbnails      string = "strip-thumbnail"
+
+	VerifyOutput            string = "verify-output"
+	VerifyDecode            string = "verify-decode"
+	VerifyDurationTolerance string = "verify-duration-tolerance"
+
+	AudioLanguages      string = "audio-languages"
+	SubtitleLanguages   string = "subtitle-languages"
+	DropStreamTypes     string = "drop-streams"
+	DropDispositions    string = "drop-dispositions"
+	ForcedSubtitlesOnly string = "forced-subtitles-only"
+
+	MuxSubtitles     string = "mux-subtitles"
+	SubtitleSidecars string = "subtitle-sidecars"
+
+	ThumbnailSidecars string = "thumbnail-sidecars"
+
+	StubMetadata string = "stub-metadata"
+
+	WatchSettle string = "watch-settle"
+	ServeAddr   string = "serve-addr"
+	ServeToken  string = "serve-token"
+	EventsURL   string = "events-url"
+	EventsToken string = "events-token"
+	StatusAddr  string = "status-addr"
+	Report      string = "report"
 )
 
 // Primary program.
@@ -90,8 +127,11 @@ const (
 // Internal filename operation keys. Not exposed to end user.
 const (
 	BatchPairs             string = "INTERNAL-batch-files"
+	WatchMode              string = "INTERNAL-watch"
+	ServeMode              string = "INTERNAL-serve"
 	FilenameOpsModels      string = "INTERNAL-filename-ops"
 	MetaOpsModels          string = "INTERNAL-meta-ops"
+	FilenamePatternModels  string = "INTERNAL-filename-patterns"
 	TranscodeVideoCodecMap string = "INTERNAL-transcode-video-codec"
 	TranscodeAudioCodecMap string = "INTERNAL-transcode-audio-codec"
 )
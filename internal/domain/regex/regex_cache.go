@@ -11,6 +11,7 @@ import (
 // Regex cache.
 var (
 	AnsiEscape                *regexp.Regexp
+	BracketedID               *regexp.Regexp
 	BracketedNumber           *regexp.Regexp
 	DateTagDetect             *regexp.Regexp
 	DateTagWithBrackets       *regexp.Regexp
@@ -24,6 +25,7 @@ var (
 
 	// Initialize sync.Once for each compilation.
 	ansiEscapeOnce          sync.Once
+	bracketedIDOnce         sync.Once
 	bracketedNumberOnce     sync.Once
 	dateTagDetectOnce       sync.Once
 	dateTagWithBracketsOnce sync.Once
@@ -116,6 +118,14 @@ func AnsiEscapeCompile() *regexp.Regexp {
 	return AnsiEscape
 }
 
+// BracketedIDCompile compiles regex for IDs in square brackets (e.g. yt-dlp's 'Title [dQw4w9WgXcQ]').
+func BracketedIDCompile() *regexp.Regexp {
+	bracketedIDOnce.Do(func() {
+		BracketedID = regexp.MustCompile(`\[([A-Za-z0-9_-]{6,})\]`)
+	})
+	return BracketedID
+}
+
 // BracketedNumberCompile compiles regex for ANSI escape codes.
 func BracketedNumberCompile() *regexp.Regexp {
 	bracketedNumberOnce.Do(func() {
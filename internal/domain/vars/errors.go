@@ -0,0 +1,79 @@
+package vars
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrorKind is the category of an error collected during a run.
+type ErrorKind string
+
+// ErrorKind definitions.
+const (
+	ErrPairing    ErrorKind = "pairing" // Finding and matching video and metadata files.
+	ErrMetaDecode ErrorKind = "metadata decode"
+	ErrMetadata   ErrorKind = "metadata" // Editing or writing metadata.
+	ErrScrape     ErrorKind = "scrape"
+	ErrFFmpeg     ErrorKind = "ffmpeg"
+	ErrRename     ErrorKind = "rename"
+	ErrMove       ErrorKind = "move"
+	ErrOther      ErrorKind = "other"
+)
+
+// ErrorKinds lists the kinds in the order they're summarized.
+var ErrorKinds = []ErrorKind{ErrPairing, ErrMetaDecode, ErrMetadata, ErrScrape, ErrFFmpeg, ErrRename, ErrMove, ErrOther}
+
+// RunError is an error collected during a run.
+type RunError struct {
+	Kind ErrorKind
+	File string // File (or URL) the error concerns.
+	Err  error
+}
+
+func (e *RunError) Error() string { return e.Err.Error() }
+func (e *RunError) Unwrap() error { return e.Err }
+
+// NewError returns an error of the given kind, so it keeps its kind when wrapped and collected later.
+func NewError(kind ErrorKind, file string, err error) error {
+	return &RunError{Kind: kind, File: file, Err: err}
+}
+
+var (
+	errorsMu  sync.Mutex
+	runErrors []RunError
+)
+
+// AddError collects an error under lock.
+//
+// If the error wraps one from NewError, that error's kind and file are used instead.
+func AddError(kind ErrorKind, file string, err error) {
+	if err == nil {
+		return
+	}
+	re := RunError{Kind: kind, File: file, Err: err}
+	var typed *RunError
+	if errors.As(err, &typed) {
+		re.Kind = typed.Kind
+		if typed.File != "" {
+			re.File = typed.File
+		}
+	}
+
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	runErrors = append(runErrors, re)
+}
+
+// GetErrors returns a copy of the collected errors.
+func GetErrors() []RunError {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	return append([]RunError(nil), runErrors...)
+}
+
+// ResetErrors clears the collected errors, e.g. between runs.
+func ResetErrors() {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	runErrors = nil
+}
@@ -0,0 +1,136 @@
+// Package events publishes structured progress events to in-process subscribers (e.g. the job API).
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type is the kind of event.
+type Type string
+
+// Event types.
+const (
+	JobQueued    Type = "job_queued"
+	JobStarted   Type = "job_started"
+	JobFinished  Type = "job_finished"
+	JobFailed    Type = "job_failed"
+	JobCancelled Type = "job_cancelled"
+
+	RunStarted  Type = "run_started"
+	RunFinished Type = "run_finished"
+
+	FileMatched    Type = "file_matched"
+	FileStarted    Type = "file_started"
+	FFmpegProgress Type = "ffmpeg_progress"
+	FileFinished   Type = "file_finished"
+	FileFailed     Type = "file_failed"
+
+	Error Type = "error"
+)
+
+// Event is a single structured event.
+type Event struct {
+	Seq        uint64    `json:"seq"`
+	Time       time.Time `json:"time"`
+	Type       Type      `json:"type"`
+	Job        string    `json:"job,omitempty"` // Job API ID (server mode only).
+	Run        string    `json:"run,omitempty"` // Undo journal ID.
+	Video      string    `json:"video,omitempty"`
+	Meta       string    `json:"meta,omitempty"`
+	FinalVideo string    `json:"final_video,omitempty"`
+	FinalMeta  string    `json:"final_meta,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	Progress   *Progress `json:"progress,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Progress is a running FFmpeg job's progress.
+type Progress struct {
+	Percent    float64 `json:"percent"`
+	OutTime    float64 `json:"out_time_seconds"`
+	Duration   float64 `json:"duration_seconds"`
+	Speed      float64 `json:"speed"`
+	ETASeconds float64 `json:"eta_seconds"`
+}
+
+var (
+	mu      sync.Mutex
+	seq     uint64
+	job     string
+	run     string
+	nextSub int
+	subs    = make(map[int]chan Event)
+	hooks   []func(Event)
+)
+
+// SetJob sets the job ID attached to events published from now on ("" for none).
+func SetJob(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	job = id
+}
+
+// SetRun sets the run ID attached to events published from now on ("" for none).
+func SetRun(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	run = id
+}
+
+// Publish sends an event to all subscribers.
+//
+// Subscribers which are not keeping up miss the event rather than stalling processing.
+func Publish(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	seq++
+	e.Seq = seq
+	e.Time = time.Now()
+	if e.Job == "" {
+		e.Job = job
+	}
+	if e.Run == "" {
+		e.Run = run
+	}
+
+	for _, h := range hooks {
+		h(e)
+	}
+	for _, ch := range subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// AddHandler registers a function called for every event, in order, from the publishing goroutine.
+//
+// Handlers must be quick and must not publish events themselves.
+func AddHandler(h func(Event)) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// Subscribe returns a channel receiving published events, and a function to unsubscribe.
+func Subscribe(buffer int) (<-chan Event, func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nextSub++
+	id := nextSub
+	ch := make(chan Event, buffer)
+	subs[id] = ch
+
+	return ch, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := subs[id]; ok {
+			delete(subs, id)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/domain/logger"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Push settings.
+const (
+	pushQueueLimit   = 1000 // Events kept while the endpoint is unreachable, oldest progress dropped first.
+	pushBatchSize    = 100  // Most events sent in one request.
+	pushInterval     = time.Second
+	pushMaxBackoff   = 30 * time.Second
+	pushTimeout      = 10 * time.Second // Per request.
+	pushCloseTimeout = 5 * time.Second  // Time allowed to send remaining events when closing.
+)
+
+// pushBody is the JSON body POSTed to the endpoint.
+type pushBody struct {
+	Program string  `json:"program"`
+	Dropped int     `json:"dropped,omitempty"` // Events dropped from a full queue since the last delivery.
+	Events  []Event `json:"events"`
+}
+
+// Pusher POSTs batches of events to an HTTP endpoint, retrying with backoff while it is unreachable.
+type Pusher struct {
+	url    string
+	token  string
+	client *http.Client
+
+	ch          <-chan Event
+	unsubscribe func()
+	done        chan struct{}
+	stopped     chan struct{}
+
+	queue   []Event
+	dropped int
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// StartPush begins sending events to the URL, with the token as a bearer token if set.
+func StartPush(url, token string) *Pusher {
+	ch, unsubscribe := Subscribe(pushQueueLimit)
+	p := &Pusher{
+		url:         url,
+		token:       token,
+		client:      &http.Client{Timeout: pushTimeout},
+		ch:          ch,
+		unsubscribe: unsubscribe,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go p.run()
+	logger.Pl.I("Sending events to %q", url)
+	return p
+}
+
+// Close stops the pusher after trying to send any remaining events.
+func (p *Pusher) Close() {
+	p.unsubscribe()
+	close(p.done)
+	<-p.stopped
+}
+
+// run queues events and sends them each interval, or sooner once a full batch is waiting.
+func (p *Pusher) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-p.ch:
+			if !ok {
+				p.ch = nil // Unsubscribed, wait for close.
+				continue
+			}
+			p.enqueue(e)
+			if len(p.queue) >= pushBatchSize && time.Now().After(p.retryAt) {
+				p.send(context.Background())
+			}
+
+		case <-ticker.C:
+			if len(p.queue) > 0 && time.Now().After(p.retryAt) {
+				p.send(context.Background())
+			}
+
+		case <-p.done:
+			if p.ch != nil {
+				for e := range p.ch {
+					p.enqueue(e)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), pushCloseTimeout)
+			defer cancel()
+			for len(p.queue) > 0 && ctx.Err() == nil {
+				if !p.send(ctx) {
+					select {
+					case <-ctx.Done():
+					case <-time.After(time.Until(p.retryAt)):
+					}
+				}
+			}
+			if len(p.queue) > 0 {
+				logger.Pl.W("Could not send %d event(s) to %q before exiting", len(p.queue), p.url)
+			}
+			return
+		}
+	}
+}
+
+// enqueue adds an event, making room in a full queue by dropping progress events first.
+//
+// Only the latest queued progress event is kept per file. Other events are only dropped (oldest
+// first) once no progress events are left, and never to make room for a progress event.
+func (p *Pusher) enqueue(e Event) {
+	if e.Type == FFmpegProgress {
+		if i := slices.IndexFunc(p.queue, func(q Event) bool { return q.Type == FFmpegProgress && q.Video == e.Video }); i >= 0 {
+			p.queue = slices.Delete(p.queue, i, i+1)
+		}
+	}
+
+	if len(p.queue) >= pushQueueLimit {
+		if p.dropped == 0 {
+			logger.Pl.W("Event queue for %q is full, dropping events", p.url)
+		}
+		p.dropped++
+
+		i := slices.IndexFunc(p.queue, func(q Event) bool { return q.Type == FFmpegProgress })
+		switch {
+		case i >= 0:
+			p.queue = slices.Delete(p.queue, i, i+1)
+		case e.Type == FFmpegProgress:
+			return
+		default:
+			p.queue = p.queue[1:]
+		}
+	}
+	p.queue = append(p.queue, e)
+}
+
+// send POSTs the oldest batch of events, returning true if the batch left the queue.
+func (p *Pusher) send(ctx context.Context) bool {
+	n := min(len(p.queue), pushBatchSize)
+	err := p.post(ctx, p.queue[:n])
+
+	var perm *permanentError
+	switch {
+	case err == nil:
+		if p.backoff > 0 {
+			logger.Pl.I("Event endpoint %q is reachable again", p.url)
+		}
+		p.backoff, p.retryAt, p.dropped = 0, time.Time{}, 0
+	case errors.As(err, &perm):
+		// Retrying won't help (e.g. a bad token), so don't block later events.
+		logger.Pl.E("Event endpoint %q rejected %d event(s): %v", p.url, n, err)
+	default:
+		if p.backoff == 0 {
+			logger.Pl.W("Failed to send events to %q, retrying: %v", p.url, err)
+		}
+		p.backoff = min(max(p.backoff*2, pushInterval), pushMaxBackoff)
+		p.retryAt = time.Now().Add(p.backoff)
+		return false
+	}
+	p.queue = p.queue[n:]
+	return true
+}
+
+// post sends one batch of events.
+func (p *Pusher) post(ctx context.Context, batch []Event) error {
+	data, err := json.Marshal(pushBody{
+		Program: "metarr",
+		Dropped: p.dropped,
+		Events:  batch,
+	})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode events: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		logger.Pl.E("Could not close response body: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("got status %s", resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("got status %s", resp.Status)}
+	}
+}
+
+// permanentError is a send failure which retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnqueue(t *testing.T) {
+	progress := func(video string) Event { return Event{Type: FFmpegProgress, Video: video} }
+	finished := func(video string) Event { return Event{Type: FileFinished, Video: video} }
+
+	// full returns a full queue of the given events, padded with 'file_started' events.
+	full := func(events ...Event) []Event {
+		q := make([]Event, 0, pushQueueLimit)
+		q = append(q, events...)
+		for len(q) < pushQueueLimit {
+			q = append(q, Event{Type: FileStarted})
+		}
+		return q
+	}
+
+	tests := []struct {
+		name        string
+		queue       []Event
+		add         Event
+		wantFirst   []Event // Start of the queue afterwards.
+		wantLast    Event
+		wantLen     int
+		wantDropped int
+	}{
+		{
+			name:      "appends",
+			queue:     []Event{finished("a")},
+			add:       progress("a"),
+			wantFirst: []Event{finished("a")},
+			wantLast:  progress("a"),
+			wantLen:   2,
+		},
+		{
+			name:      "keeps the latest progress per file",
+			queue:     []Event{progress("a"), progress("b"), finished("c")},
+			add:       progress("a"),
+			wantFirst: []Event{progress("b"), finished("c")},
+			wantLast:  progress("a"),
+			wantLen:   3,
+		},
+		{
+			name:        "full queue drops progress first",
+			queue:       full(finished("a"), progress("b")),
+			add:         finished("c"),
+			wantFirst:   []Event{finished("a"), {Type: FileStarted}},
+			wantLast:    finished("c"),
+			wantLen:     pushQueueLimit,
+			wantDropped: 1,
+		},
+		{
+			name:        "full queue without progress drops the oldest",
+			queue:       full(finished("a"), finished("b")),
+			add:         finished("c"),
+			wantFirst:   []Event{finished("b")},
+			wantLast:    finished("c"),
+			wantLen:     pushQueueLimit,
+			wantDropped: 1,
+		},
+		{
+			name:        "full queue never drops other events for progress",
+			queue:       full(finished("a")),
+			add:         progress("b"),
+			wantFirst:   []Event{finished("a")},
+			wantLast:    Event{Type: FileStarted},
+			wantLen:     pushQueueLimit,
+			wantDropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pusher{queue: slices.Clone(tt.queue)}
+			p.enqueue(tt.add)
+
+			if len(p.queue) != tt.wantLen {
+				t.Fatalf("queue has %d events, want %d", len(p.queue), tt.wantLen)
+			}
+			if !slices.EqualFunc(p.queue[:len(tt.wantFirst)], tt.wantFirst, sameEvent) {
+				t.Errorf("queue starts with %v, want %v", p.queue[:len(tt.wantFirst)], tt.wantFirst)
+			}
+			if last := p.queue[len(p.queue)-1]; !sameEvent(last, tt.wantLast) {
+				t.Errorf("queue ends with %v, want %v", last, tt.wantLast)
+			}
+			if p.dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", p.dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+// sameEvent compares the fields set by TestEnqueue.
+func sameEvent(a, b Event) bool {
+	return a.Type == b.Type && a.Video == b.Video
+}
@@ -9,49 +9,42 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
+	"metarr/internal/ffprobe"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
+	"metarr/internal/plan"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
 )
 
-// availableCodecsCache caches the codecs in FFmpeg to avoid repeated calls.
-var (
-	availableCodecsCache     string
-	availableCodecsCacheOnce sync.Once
-)
-
 // ffCommandBuilder handles FFmpeg command construction.
 type ffCommandBuilder struct {
 	// Files
-	inputFile  string
-	outputFile string
+	inputFile      string
+	outputFile     string
+	thumbnailInput string // New cover art added as a second input (MP4-family only).
+	sidecarJPG     string // Local JPG of the thumbnail sidecar (the sidecar itself, or a converted copy).
+	sidecarTemp    bool   // Whether sidecarJPG is a temporary converted copy.
+	thumbnailJPG   string // Local JPG of a thumbnail sidecar which was embedded.
 
 	// Maps
-	formatFlagsMap map[string]string
-	metadataMap    map[string]string
+	metadataMap map[string]string
 
 	// HW accel
 	gpuAccelFlags      []string
 	gpuNode            []string
 	accelCompatibility []string
 
-	// Video codecs
-	videoCodecGPU      []string
-	videoCodecSoftware []string
-
-	// Audio codec
-	audioCodec []string
-	audioRate  []string
-
-	// Thumbnail
-	thumbnail []string
+	// Streams
+	streams       []streamPlan
+	streamMapping []string
+	sidecarsDone  []string // Subtitle sidecars now contained in the output.
 
 	// Other parameters
 	qualityParameter []string
@@ -71,139 +64,194 @@ func newFfCommandBuilder(fd *models.FileData, outputFile string) *ffCommandBuild
 }
 
 // buildCommand constructs the complete FFmpeg command.
-func (b *ffCommandBuilder) buildCommand(ctx context.Context, fd *models.FileData, desiredVCodec, desiredACodec, outExt string) ([]string, error) {
+func (b *ffCommandBuilder) buildCommand(ctx context.Context, fd *models.FileData, outExt string) ([]string, error) {
 	if b.inputFile == "" || b.outputFile == "" {
 		return nil, fmt.Errorf("input file or output file is empty.\n\nInput file: %v\nOutput file: %v", b.inputFile, b.outputFile)
 	}
 
-	// Grab current codecs.
-	currentVCodec, currentACodec, err := checkCodecs(b.inputFile)
+	// Streams are mapped one by one, so the input must be probed.
+	probe, err := ffprobe.Probe(ctx, fd)
 	if err != nil {
-		logger.Pl.E("Failed to check codecs in file %q: %v", b.inputFile, err)
+		return nil, fmt.Errorf("cannot plan streams for %q: %w", b.inputFile, err)
 	}
-	availableCodecsCacheOnce.Do(func() {
-		availableCodecsCache = b.ffmpegAvailableCodecs(ctx)
-	})
-	availableCodecs := availableCodecsCache
 
-	// Get GPU flags/codecs.
-	accelType, useHWDecode := b.setHWAccelFlags()
-	b.setGPUAccelerationCodec(accelType, desiredVCodec, availableCodecs)
+	// Reset state from any previous attempt.
+	b.gpuAccelFlags, b.gpuNode, b.accelCompatibility, b.qualityParameter = nil, nil, nil, nil
 
-	logger.Pl.D(1, "Transcoding to codec %q from current codec %q", desiredVCodec, currentVCodec)
-
-	// Get software codecs.
-	if b.videoCodecGPU == nil {
-		b.setVideoSoftwareCodec(currentVCodec, desiredVCodec, availableCodecs)
-	}
-	b.setAudioCodec(currentACodec, desiredACodec, availableCodecs)
+	// Get GPU flags.
+	accelType, useHWDecode := b.setHWAccelFlags()
 	b.setTranscodeQuality(accelType)
 
-	b.setDefaultFormatFlagMap(outExt)
-	args := b.setFormatFlags()
-	b.addAllMetadata(fd)
-
+	// Get new thumbnail.
+	ext := strings.ToLower(outExt)
 	stripThumbnails := false
 	if abstractions.IsSet(keys.StripThumbnails) {
 		stripThumbnails = abstractions.GetBool(keys.StripThumbnails)
 	}
+	var thumbnail string
 	if !stripThumbnails {
-		b.setThumbnail(fd.MWebData.Thumbnail, parsing.GetBaseNameWithoutExt(fd.OriginalVideoPath), outExt, fd.HasEmbeddedThumbnail)
+		thumbnail = b.getThumbnail(fd)
 	}
 
+	// Decide codecs per stream.
+	planner := newStreamPlanner(ctx, b.inputFile, ext, accelType)
+	planner.dropPics = stripThumbnails || (thumbnail != "" && supportsAttachedPicDisposition(ext))
+	planner.dropImageAttachments = stripThumbnails || (thumbnail != "" && ext == sharedconsts.ExtMKV)
+	planner.sidecars = fd.Subtitles
+	b.streams = planner.plan(probe)
+	b.sidecarsDone = planner.sidecarsDone
+
+	for _, sp := range b.streams {
+		if sp.gpu {
+			logger.Pl.I("Using hardware acceleration:\n\nType: %s\nStream: %d\nCodec: %s\n", accelType, sp.inIndex, sp.encoder)
+		}
+	}
+
+	b.setStreamMapping(ext, thumbnail)
+	b.addAllMetadata(fd)
+
 	// Return the fully appended argument string.
-	return b.buildFinalCommand(args, useHWDecode)
+	return b.buildFinalCommand(useHWDecode)
+}
+
+// setStreamMapping maps every planned input stream with its codec, then adds the new thumbnail if present.
+func (b *ffCommandBuilder) setStreamMapping(outExt, thumbnail string) {
+	b.thumbnailInput, b.thumbnailJPG = "", ""
+	b.streamMapping = streamArgs(b.streams, outExt, b.accelCompatibility)
+	if thumbnail == "" {
+		return
+	}
+
+	switch {
+	case supportsAttachedPicDisposition(outExt):
+		spec := "v:" + strconv.Itoa(countPlanned(b.streams, models.StreamVideo))
+		b.thumbnailInput = thumbnail
+		b.markSidecarEmbedded(thumbnail)
+		b.streamMapping = append(b.streamMapping,
+			"-map", strconv.Itoa(len(b.sidecarInputs())+1), // map new thumbnail (input after sidecars).
+			"-c:"+spec, "mjpeg", // always use mjpeg codec for thumbnail.
+			"-disposition:"+spec, "attached_pic", // mark as cover art.
+		)
+
+	case outExt == sharedconsts.ExtMKV:
+		b.markSidecarEmbedded(thumbnail)
+		b.streamMapping = append(b.streamMapping,
+			"-attach", thumbnail,
+			"-metadata:s:t:"+strconv.Itoa(countPlanned(b.streams, models.StreamAttachment)), "mimetype=image/jpeg",
+		)
+
+	default:
+		logger.Pl.D(1, "Thumbnail embedding not supported for extension: %s", outExt)
+	}
+}
+
+// markSidecarEmbedded records the thumbnail sidecar as embedded, if it's the thumbnail being used.
+func (b *ffCommandBuilder) markSidecarEmbedded(thumbnail string) {
+	if thumbnail != "" && thumbnail == b.sidecarJPG {
+		b.thumbnailJPG = thumbnail
+	}
+}
+
+// sidecarInputs returns the subtitle sidecar paths in input order.
+func (b *ffCommandBuilder) sidecarInputs() []string {
+	var paths []string
+	for _, sp := range b.streams {
+		if sp.sidecar != "" {
+			paths = append(paths, sp.sidecar)
+		}
+	}
+	return paths
 }
 
-// setThumbnail sets the thumbnail image in the video metadata.
+// prepareSidecarThumbnail readies the video's thumbnail sidecar for embedding, converting it to JPG if needed.
 //
-// NOTE: Uses -map to avoid accumulating thumbnails, if numerous functions need -map additions at some point,
-// it will be necessary to create something like a b.streamMapping field and setStreamMapping() function.
-func (b *ffCommandBuilder) setThumbnail(thumbnailURL, videoBaseName, outExt string, hasEmbeddedThumbnail bool) {
-	if thumbnailURL == "" {
-		if hasEmbeddedThumbnail {
-			logger.Pl.I("Video %q has an embedded thumbnail. Will copy existing attached_pic.", b.inputFile)
-
-			switch strings.ToLower(outExt) {
-			case sharedconsts.ExtMP4,
-				sharedconsts.ExtM4V,
-				sharedconsts.ExtMOV:
-
-				b.thumbnail = []string{
-					"-map", "0:V", // Map only regular video streams (excludes existing attached_pic).
-					"-map", "0:a?", // Map audio streams if present.
-					"-map", "0:s?", // Map subtitle streams if present.
-					"-map", "0:d?", // Map data streams if present.
-					"-map", "0:t?", // Map attachment streams if present.
-					"-map", "0:v", // Now map attached_pic (will be only the first one found).
-					"-c", "copy",
-					"-disposition:v:1", "attached_pic",
-				}
-
-			case sharedconsts.ExtMKV:
-				b.thumbnail = []string{
-					"-map", "0",
-					"-c", "copy",
-				}
-
-			default:
-				logger.Pl.D(1, "Copying attached thumbnails not supported for extension: %s", outExt)
-			}
-			return
+// Runs once per video, so retries reuse the converted copy.
+func (b *ffCommandBuilder) prepareSidecarThumbnail(fd *models.FileData) {
+	sidecar := fd.ThumbnailSidecar
+	if sidecar == "" || abstractions.GetBool(keys.StripThumbnails) {
+		return
+	}
+	if plan.Enabled() || isJPG(sidecar) {
+		b.sidecarJPG = sidecar
+		return
+	}
+
+	// Unique per video, as several workers may convert sidecars of the same name.
+	tmp, err := os.CreateTemp("", "thumb_*.jpg")
+	if err != nil {
+		logger.Pl.E("Could not create temporary file to convert local thumbnail %q: %v", sidecar, err)
+		return
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		logger.Pl.E("Failed to close temporary file %q: %v", tmpPath, err)
+	}
+
+	if _, err := convertToJPG(sidecar, tmpPath); err != nil {
+		logger.Pl.E("Could not convert local thumbnail %q to JPG: %v", sidecar, err)
+		if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+			logger.Pl.E("Failed to remove %q: %v", tmpPath, err)
 		}
 		return
 	}
+	b.sidecarJPG, b.sidecarTemp = tmpPath, true
+}
+
+// removeSidecarTemp removes the converted copy of the thumbnail sidecar, if one is left.
+func (b *ffCommandBuilder) removeSidecarTemp() {
+	if !b.sidecarTemp {
+		return
+	}
+	if err := os.Remove(b.sidecarJPG); err != nil && !os.IsNotExist(err) {
+		logger.Pl.E("Failed to remove %q: %v", b.sidecarJPG, err)
+	}
+}
+
+// getThumbnail returns the local JPG path of the thumbnail to embed (empty if unavailable).
+//
+// A local image saved beside the video takes priority over downloading the metadata URL.
+func (b *ffCommandBuilder) getThumbnail(fd *models.FileData) string {
+	videoBaseName := parsing.GetBaseNameWithoutExt(fd.OriginalVideoPath)
+
+	if b.sidecarJPG != "" {
+		logger.Pl.I("Using local thumbnail %q", fd.ThumbnailSidecar)
+		return b.sidecarJPG
+	}
 
-	// Thumbnail URL not "" beyond here...
+	thumbnailURL := fd.MWebData.Thumbnail
+	if thumbnailURL == "" {
+		return ""
+	}
+
+	// The URL stands in for the file in dry-run mode.
+	if plan.Enabled() {
+		return thumbnailURL
+	}
 
-	// Download local thumbnail.
 	thumbnail, err := downloadThumbnail(thumbnailURL, videoBaseName)
 	if err != nil {
 		logger.Pl.E("Could not download thumbnail %q: %v", thumbnailURL, err)
-		return
+		return ""
 	}
 
 	// Ensure JPG.
-	thumbExt := strings.ToLower(filepath.Ext(thumbnail))
-	if thumbExt != ".jpg" && thumbExt != ".jpeg" {
-		if thumbnail, err = convertToJPG(thumbnail); err != nil {
+	if !isJPG(thumbnail) {
+		if thumbnail, err = convertToJPG(thumbnail, parsing.GetFilepathWithoutExt(thumbnail)+".jpg"); err != nil {
 			logger.Pl.E("Could not convert thumbnail %q to JPG: %v", thumbnail, err)
-			return
+			return ""
 		}
 	}
+	return thumbnail
+}
 
-	ext := strings.ToLower(outExt)
-	switch ext {
-	case sharedconsts.ExtMP4,
-		sharedconsts.ExtM4V,
-		sharedconsts.ExtMOV:
-
-		b.thumbnail = []string{
-			"-i", thumbnail, // add the thumbnail as a second input.
-			"-map", "0:V", // map only regular video streams (excludes any existing attached_pic).
-			"-map", "0:a?", // map audio streams if present.
-			"-map", "0:s?", // map subtitle streams if present.
-			"-map", "0:d?", // map data streams if present.
-			"-map", "0:t?", // map attachment streams if present.
-			"-map", "1", // map new thumbnail.
-			"-c:v:1", "mjpeg", // always use mjpeg codec for thumbnail.
-			"-disposition:v:1", "attached_pic", // mark as cover art.
-		}
-
-	case sharedconsts.ExtMKV:
-		b.thumbnail = []string{
-			"-attach", thumbnail,
-			"-metadata:s:t", "mimetype=image/jpeg",
-		}
-
-	default:
-		logger.Pl.D(1, "Thumbnail embedding not supported for extension: %s", ext)
-	}
+// isJPG returns true if the path has a JPG extension.
+func isJPG(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
 }
 
 // convertToJPG converts an inputted file format to JPG for embedding.
-func convertToJPG(inputPath string) (string, error) {
-	outputPath := parsing.GetFilepathWithoutExt(inputPath) + ".jpg"
+func convertToJPG(inputPath, outputPath string) (string, error) {
 	cmd := exec.Command("ffmpeg", "-y", "-i", inputPath, outputPath)
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("failed to convert %q to jpg: %w", filepath.Ext(inputPath), err)
@@ -275,123 +323,6 @@ func downloadThumbnail(urlStr, videoBaseName string) (string, error) {
 	return tmpPath, nil
 }
 
-// setAudioCodec gets the audio codec for transcode operations.
-func (b *ffCommandBuilder) setAudioCodec(currentACodec, desiredACodec, availableCodecs string) {
-	switch desiredACodec {
-	case sharedconsts.ACodecCopy, currentACodec, "": // -- Set and return early. --
-		b.audioCodec = []string{consts.FFmpegCA, sharedconsts.ACodecCopy} // Hardcoded copy (do not use 'desiredACodec').
-		return
-
-	case sharedconsts.ACodecAAC, // -- No audio rate needed. --
-		sharedconsts.ACodecALAC,
-		sharedconsts.ACodecFLAC,
-		sharedconsts.ACodecMP2,
-		sharedconsts.ACodecMP3,
-		sharedconsts.ACodecOpus,
-		sharedconsts.ACodecPCM,
-		sharedconsts.ACodecVorbis,
-		sharedconsts.ACodecTrueHD:
-
-		b.audioCodec = []string{consts.FFmpegCA, desiredACodec}
-
-	case sharedconsts.ACodecAC3, // -- 48KHz audio rate required. --
-		sharedconsts.ACodecDTS,
-		sharedconsts.ACodecEAC3:
-		b.audioCodec = []string{consts.FFmpegCA, desiredACodec}
-		b.audioRate = []string{consts.FFmpegAR, consts.AudioRate48khz}
-
-	case sharedconsts.ACodecWAV:
-		b.audioCodec = []string{consts.FFmpegCA, "pcm_s16le"}
-
-	default:
-		b.audioCodec = nil // -- Invalid or un-set codec. --
-	}
-
-	// Check codec availability.
-	if len(b.audioCodec) >= 2 {
-		if !strings.Contains(availableCodecs, b.audioCodec[1]) {
-			logger.Pl.W("Audio codec %q not available in FFmpeg build, falling back to software.", b.audioCodec[1])
-			b.audioCodec = []string{consts.FFmpegCA, sharedconsts.ACodecCopy}
-		}
-	} else if b.audioCodec != nil {
-		logger.Pl.E("%s Strings expected to be at least parts, got %v", consts.LogTagDevError, b.audioCodec)
-		b.audioCodec = nil
-	}
-}
-
-// setVideoSoftwareCodec gets the audio codec for transcode operations.
-func (b *ffCommandBuilder) setVideoSoftwareCodec(currentVCodec, desiredVCodec, availableCodecs string) {
-	switch desiredVCodec {
-	case sharedconsts.VCodecCopy, currentVCodec, "": // -- Set and return early. --
-		b.videoCodecSoftware = []string{consts.FFmpegCV0, consts.FFVCodecKeyCopy} // Hardcoded copy (do not use 'desiredVCodec').
-		return
-
-	// Software codecs.
-	case sharedconsts.VCodecAV1, // -- Software codecs. --
-		sharedconsts.VCodecH264,
-		sharedconsts.VCodecHEVC,
-		sharedconsts.VCodecMPEG2,
-		sharedconsts.VCodecVP8,
-		sharedconsts.VCodecVP9:
-		b.videoCodecSoftware = []string{consts.FFmpegCV0, consts.VCodecToFFVCodec[desiredVCodec]}
-
-	default:
-		b.videoCodecSoftware = nil // -- Invalid or un-set codec. --
-	}
-
-	// Check codec availability.
-	if len(b.videoCodecSoftware) >= 2 {
-		if !strings.Contains(availableCodecs, b.videoCodecSoftware[1]) {
-			logger.Pl.W("Video codec %q not available in FFmpeg build, falling back to software.", b.videoCodecSoftware[1])
-			b.videoCodecSoftware = []string{consts.FFmpegCV0, sharedconsts.VCodecCopy}
-		}
-	} else if b.videoCodecSoftware != nil {
-		logger.Pl.E("%s Strings expected to be at least 2 parts, got %v", consts.LogTagDevError, b.videoCodecSoftware)
-		b.videoCodecSoftware = nil
-	}
-}
-
-// ffmpegAvailableCodecs lists codecs available in FFmpeg.
-func (b *ffCommandBuilder) ffmpegAvailableCodecs(ctx context.Context) (output string) {
-	cmd := exec.CommandContext(ctx, "ffmpeg", "-encoders")
-	outBytes, err := cmd.Output()
-	result := strings.TrimSpace(string(outBytes))
-	if err != nil {
-		logger.Pl.E("Codec Grab Failed: %v", err)
-		return ""
-	}
-	return result
-}
-
-// setGPUAccelerationCodec sets the codec to use for the GPU acceleration (separated from setGPUAcceleration for ordering reasons).
-func (b *ffCommandBuilder) setGPUAccelerationCodec(accelType, useTranscodeCodec, availableCodecs string) {
-	if accelType == "" || accelType == sharedconsts.AccelTypeAuto {
-		logger.Pl.D(2, "Using 'auto' HW acceleration, will use a standard software codec (e.g. 'libx264')")
-		return
-	}
-
-	// Build codec string '<codec>_<accelerator>'
-	gpuCodecString := useTranscodeCodec + "_"
-	if accelType == sharedconsts.AccelTypeCuda {
-		gpuCodecString += consts.AccelFlagNvenc
-	} else {
-		gpuCodecString += accelType
-	}
-	b.videoCodecGPU = []string{consts.FFmpegCV0, gpuCodecString}
-
-	// Check codec availability and set nil if not available.
-	if !strings.Contains(availableCodecs, gpuCodecString) {
-		logger.Pl.W("GPU-bound video codec %q not available in FFmpeg build, falling back to software.", gpuCodecString)
-		b.videoCodecGPU = nil
-	}
-
-	// Log GPU args.
-	if b.gpuAccelFlags != nil && b.videoCodecGPU != nil {
-		logCommand := append(b.gpuAccelFlags, b.videoCodecGPU...)
-		logger.Pl.I("Using hardware acceleration:\n\nType: %s\nCodec: %s\nArguments: %v\n", accelType, useTranscodeCodec, logCommand)
-	}
-}
-
 // setHWAccelFlags checks and returns the flags for HW acceleration.
 func (b *ffCommandBuilder) setHWAccelFlags() (accelType string, useHWDecode bool) {
 	if !abstractions.IsSet(keys.TranscodeGPU) {
@@ -474,74 +405,8 @@ func (b *ffCommandBuilder) setTranscodeQuality(accelType string) {
 	}
 }
 
-// setDefaultFormatFlagMap adds commands specific for the extension input and output.
-func (b *ffCommandBuilder) setDefaultFormatFlagMap(outExt string) {
-	inExt := strings.ToLower(filepath.Ext(b.inputFile))
-	outExt = strings.ToLower(outExt)
-
-	if outExt == "" || strings.EqualFold(inExt, outExt) {
-		b.formatFlagsMap = copyPreset
-		return
-	}
-
-	logger.Pl.D(2, "Making default format map for input extension: %q, output extension: %q. (File: %q)",
-		inExt, outExt, b.inputFile)
-
-	// Get format preset from map.
-	b.formatFlagsMap = copyPreset
-	// Fall back to copy preset if no mapping found.
-	b.formatFlagsMap = copyPreset
-	logger.Pl.D(1, "No format mapping found for %s to %s conversion, using copy preset",
-		inExt, outExt)
-}
-
-// setFormatFlags sets flags for the transcoding format, e.g. codec, etc.
-func (b *ffCommandBuilder) setFormatFlags() (args []string) {
-	// Add video codec.
-	if len(b.videoCodecGPU) != 0 { // Priority #1: GPU codec.
-		args = append(args, b.videoCodecGPU...)
-	} else if len(b.videoCodecSoftware) != 0 { // Priority #2: Software codec.
-		args = append(args, b.videoCodecSoftware...)
-	} else if vCodec, exists := b.formatFlagsMap[consts.FFmpegCV0]; exists { // Priority #3: Format preset codec.
-		args = append(args, consts.FFmpegCV0, vCodec)
-	}
-
-	// Add audio codec.
-	if len(b.audioCodec) != 0 { // Priority #1: Set audio codec.
-		args = append(args, b.audioCodec...)
-	} else if aCodec, exists := b.formatFlagsMap[consts.FFmpegCA]; exists { // Priority #2: Format preset codec.
-		args = append(args, consts.FFmpegCA, aCodec)
-	}
-
-	// Add audio rate.
-	if len(b.audioRate) != 0 {
-		args = append(args, b.audioRate...)
-	}
-
-	// Add subtitle.
-	if subtitle, exists := b.formatFlagsMap[consts.FFmpegCS]; exists {
-		args = append(args, consts.FFmpegCS, subtitle)
-	}
-
-	// Add data stream.
-	if subtitle, exists := b.formatFlagsMap[consts.FFmpegCD]; exists {
-		args = append(args, consts.FFmpegCD, subtitle)
-	}
-
-	// Add attachment.
-	if attachment, exists := b.formatFlagsMap[consts.FFmpegCT]; exists {
-		args = append(args, consts.FFmpegCT, attachment)
-	}
-
-	// Add quality.
-	if len(b.qualityParameter) != 0 {
-		args = append(args, b.qualityParameter...)
-	}
-	return args
-}
-
 // buildFinalCommand assembles the final FFmpeg command.
-func (b *ffCommandBuilder) buildFinalCommand(formatArgs []string, useHWDecode bool) ([]string, error) {
+func (b *ffCommandBuilder) buildFinalCommand(useHWDecode bool) ([]string, error) {
 	args := make([]string, 0, b.calculateCommandCapacity())
 
 	// Add HW acceleration flags (only for decode mode).
@@ -559,18 +424,22 @@ func (b *ffCommandBuilder) buildFinalCommand(formatArgs []string, useHWDecode bo
 	// Add input file (main video).
 	args = append(args, "-y", "-i", b.inputFile)
 
-	// If thumbnail present, add it as an input (must appear before metadata).
-	if len(b.thumbnail) > 0 {
-		args = append(args, b.thumbnail...)
+	// Add subtitle sidecars as inputs 1..n.
+	for _, path := range b.sidecarInputs() {
+		args = append(args, "-i", path)
+	}
+
+	// If thumbnail present, add it as an input (must appear before output options).
+	if b.thumbnailInput != "" {
+		args = append(args, "-i", b.thumbnailInput)
 	}
 
-	// Add format and codec flags.
-	args = append(args, formatArgs...)
+	// Add stream maps and per-stream codecs.
+	args = append(args, b.streamMapping...)
 
-	// Apply GPU compatibility filters only to the main video stream (stream 0).
-	if len(b.accelCompatibility) > 0 {
-		args = append(args, consts.FFmpegFilter)
-		args = append(args, b.accelCompatibility...)
+	// Add quality.
+	if len(b.qualityParameter) != 0 {
+		args = append(args, b.qualityParameter...)
 	}
 
 	outputExt := filepath.Ext(b.outputFile)
@@ -601,6 +470,9 @@ func (b *ffCommandBuilder) buildFinalCommand(formatArgs []string, useHWDecode bo
 		args = append(args, strings.Fields(abstractions.GetString(keys.ExtraFFmpegArgs))...)
 	}
 
+	// Report progress on stdout instead of the stats line on stderr.
+	args = append(args, "-progress", "pipe:1", "-nostats")
+
 	// Add output file last.
 	args = append(args, b.outputFile)
 
@@ -612,6 +484,7 @@ func (b *ffCommandBuilder) calculateCommandCapacity() int {
 	const (
 		base = 2 + // "-y", "-i"
 			1 + // <input file>
+			3 + // "-progress", "pipe:1", "-nostats"
 			1 // <output file>
 
 		mapArgMultiply = 2 // "-metadata" + "key=value"
@@ -621,13 +494,12 @@ func (b *ffCommandBuilder) calculateCommandCapacity() int {
 	totalCapacity += (len(b.metadataMap) * mapArgMultiply)
 	totalCapacity += len(b.gpuAccelFlags)
 	totalCapacity += len(b.gpuNode)
-	totalCapacity += len(b.accelCompatibility)
-	totalCapacity += len(b.videoCodecGPU)
-	totalCapacity += len(b.videoCodecSoftware)
-	totalCapacity += len(b.audioCodec)
+	totalCapacity += len(b.streamMapping)
 	totalCapacity += len(b.qualityParameter)
-	totalCapacity += len(b.formatFlagsMap)
-	totalCapacity += len(b.thumbnail)
+	if b.thumbnailInput != "" {
+		totalCapacity += 2 // "-i" and thumbnail.
+	}
+	totalCapacity += len(b.sidecarInputs()) * 2 // "-i" and sidecar.
 
 	if abstractions.IsSet(keys.TranscodeVideoFilter) {
 		totalCapacity += 2 // -vf and flag.
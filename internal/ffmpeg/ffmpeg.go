@@ -5,26 +5,29 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"metarr/internal/abstractions"
 	"metarr/internal/domain/consts"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
-	"metarr/internal/domain/vars"
+	"metarr/internal/ffprobe"
 	"metarr/internal/file"
+	"metarr/internal/journal"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
+	"metarr/internal/plan"
+	"metarr/internal/progress"
+	"metarr/internal/report"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"slices"
 	"strings"
+	"time"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
 )
 
 // ExecuteVideo writes metadata to a single video file.
-func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
+func ExecuteVideo(ctx context.Context, fd *models.FileData) (err error) {
 	var (
 		tmpOutPath, outExt string
 	)
@@ -42,27 +45,23 @@ func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
 		outExt = origExt
 	}
 
-	// Get current codecs.
-	currentVCodec, currentACodec, err := checkCodecs(fd.OriginalVideoPath)
+	// Plan streams to check whether anything needs re-encoding or dropping.
+	probe, err := ffprobe.Probe(ctx, fd)
 	if err != nil {
-		logger.Pl.E("Failed to check input file %q codec: %v", fd.OriginalVideoPath, err)
-	}
-
-	// Check codec mismatches.
-	desiredVCodec := getOutputVideoCodecString(currentVCodec)
-	desiredACodec := getOutputAudioCodecString(currentACodec)
-
-	// Check incompatibility with extension type.
-	compatSlice := consts.IncompatibleCodecsForContainer[outExt]
-	if slices.Contains(compatSlice, desiredVCodec) {
-		logger.Pl.I("Desired codec %q is not compatible with video container %q, falling back to 'copy'.", desiredVCodec, outExt)
-		desiredVCodec = sharedconsts.VCodecCopy
+		return fmt.Errorf("failed to probe input file %q: %w", origPath, err)
 	}
+	planner := newStreamPlanner(ctx, origPath, outExt, "")
+	planner.sidecars = fd.Subtitles
+	streamChanges := needsTranscode(planner.plan(probe)) || planner.selectionDrops > 0 || planner.sidecarsMuxed > 0
 
 	// Return early if no processing is needed.
-	if skipProcessing(fd, currentVCodec, desiredVCodec, currentACodec, desiredACodec, outExt) {
+	if skipProcessing(fd, streamChanges, outExt) {
 		return nil
 	}
+	start := time.Now()
+	defer func() {
+		report.AddStage(fd, report.StageFFmpeg, start, err)
+	}()
 	logger.Pl.I("Will execute video from extension %q → %q", origExt, outExt)
 
 	// Set temp output path: DO NOT use user cache or temp dir, can cause cross-device link move failures.
@@ -70,7 +69,9 @@ func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
 	tmpOutPath = filepath.Join(fd.VideoDirectory, consts.TempTag+fileBase+origExt+outExt)
 	logger.Pl.D(3, "Orig ext: %q, Out ext: %q", origExt, outExt)
 
-	// Remove temp file on function end.
+	// Keep recovery off the temp file while it's in use, and remove it on function end.
+	file.HoldTemp(tmpOutPath)
+	defer file.ReleaseTemp(tmpOutPath)
 	defer func() {
 		if _, err := os.Stat(tmpOutPath); err == nil {
 			if err := os.Remove(tmpOutPath); err != nil {
@@ -91,27 +92,48 @@ func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
 	// Run the FFmpeg command (n total attempts).
 	maxAttempts := 3
 	builder := newFfCommandBuilder(fd, tmpOutPath)
+	builder.prepareSidecarThumbnail(fd)
+	defer builder.removeSidecarTemp()
+
+	// Record the command and file swaps instead of running them in dry-run mode.
+	if plan.Enabled() {
+		args, err := builder.buildCommand(ctx, fd, outExt)
+		if err != nil {
+			return err
+		}
+		plan.SetFFmpegArgv(fd, args)
+		report.SetFFmpegArgv(fd, args)
+
+		if filepath.Ext(origPath) != filepath.Ext(fd.PostFFmpegVideoPath) {
+			plan.AddOperation(fd, plan.OpDelete, origPath, "")
+		} else if abstractions.GetBool(keys.NoFileOverwrite) && origPath == fd.PostFFmpegVideoPath {
+			plan.AddOperation(fd, plan.OpBackup, origPath, file.GenerateBackupFilename(origPath))
+		}
+		plan.AddOperation(fd, plan.OpReplace, tmpOutPath, fd.PostFFmpegVideoPath)
+		if builder.thumbnailJPG != "" {
+			if err := file.HandleThumbnailSidecar(fd, fd.ThumbnailSidecar, builder.thumbnailJPG); err != nil {
+				return err
+			}
+		}
+		return file.HandleSubtitleSidecars(fd, builder.sidecarsDone)
+	}
 
 	for i := 1; i <= maxAttempts; i++ {
 		// Build command.
-		args, err := builder.buildCommand(ctx, fd, desiredVCodec, desiredACodec, outExt)
+		args, err := builder.buildCommand(ctx, fd, outExt)
 		if err != nil {
 			return err
 		}
 		command := exec.CommandContext(ctx, "ffmpeg", args...)
+		report.SetFFmpegArgv(fd, args)
 		logger.Pl.I("Constructed FFmpeg command for %q:\n\n%v\n", fd.OriginalVideoPath, command.String())
 
-		// Set command output to stdout/stderr.
+		// Run command (stderr is captured for error reports, progress is read from stdout).
 		var stderr bytes.Buffer
-		command.Stdout = os.Stdout
-		command.Stderr = io.MultiWriter(os.Stderr, &stderr)
-
-		// Run command.
 		logger.Pl.P("%s!!! Starting FFmpeg attempt %d for %q...\n%s", sharedconsts.ColorCyan, i, baseName, sharedconsts.ColorReset)
-		if err := command.Run(); err != nil {
+		if err := runWithProgress(command, fd, &stderr); err != nil {
 			// Exit if final attempt errored.
 			if i == maxAttempts {
-				vars.AddToErrorArray(err)
 				return fmt.Errorf("ffmpeg failed after %d attempts for %q due to error: %w\n\nCaptured output:\n%s", maxAttempts, baseName, err, stderr.String())
 			}
 
@@ -124,30 +146,38 @@ func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
 		break
 	}
 
-	// Rename temporary file to overwrite the original video file, make backup if needed.
+	// Verify output before touching the original.
+	if err := verifyOutput(ctx, fd, tmpOutPath, builder.streams); err != nil {
+		return fmt.Errorf("output verification failed for %q, original left in place: %w", baseName, err)
+	}
+
+	// Swap temp file in for the original video, keep a backup if needed.
+	keepBackup := false
 	if filepath.Ext(origPath) != filepath.Ext(fd.PostFFmpegVideoPath) {
 		logger.Pl.I("Original file not type %s, removing %q", outExt, origPath)
 	} else if abstractions.GetBool(keys.NoFileOverwrite) && origPath == fd.PostFFmpegVideoPath {
-		if err := makeBackup(origPath); err != nil {
-			return err
-		}
+		keepBackup = true
 	}
 
-	// Delete original after potential backup ops.
-	err = os.Remove(origPath)
+	backupPath, err := file.SwapInVideo(origPath, tmpOutPath, fd.PostFFmpegVideoPath, keepBackup)
 	if err != nil {
-		vars.AddToErrorArray(err)
-		return fmt.Errorf("failed to remove original file (%s). Error: %w", origPath, err)
+		return fmt.Errorf("failed to replace original file (%s): %w", origPath, err)
 	}
+	ffprobe.Invalidate(fd)
+	journal.RecordTranscode(origPath, fd.PostFFmpegVideoPath, backupPath)
 
-	// Move temp file to post-FFmpeg video path.
-	err = os.Rename(tmpOutPath, fd.PostFFmpegVideoPath)
-	if err != nil {
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	// Sidecar files are now in the video.
+	if builder.thumbnailJPG != "" {
+		if err := file.HandleThumbnailSidecar(fd, fd.ThumbnailSidecar, builder.thumbnailJPG); err != nil {
+			logger.Pl.E("Failed to clean up thumbnail for %q: %v", fd.PostFFmpegVideoPath, err)
+		}
+	}
+	if err := file.HandleSubtitleSidecars(fd, builder.sidecarsDone); err != nil {
+		logger.Pl.E("Failed to clean up subtitle files for %q: %v", fd.PostFFmpegVideoPath, err)
 	}
 
 	// Log success.
-	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(progress.Stderr, "\n")
 	logger.Pl.S("Successfully processed video:\n\nOriginal file: %s\nNew file: %s\n\nTitle: %s", origPath,
 		fd.PostFFmpegVideoPath,
 		fd.MTitleDesc.Title)
@@ -155,21 +185,19 @@ func ExecuteVideo(ctx context.Context, fd *models.FileData) error {
 	return nil
 }
 
-// skipProcessing determines whether the program should process this video (meta already exists, file extensions are unchanged, and codecs match).
-func skipProcessing(fd *models.FileData, currentVCodec, desiredVCodec, currentACodec, desiredACodec, outExt string) (skipProcessing bool) {
+// skipProcessing determines whether the program should process this video (meta already exists, file extensions are unchanged, and no stream needs transcoding or dropping).
+func skipProcessing(fd *models.FileData, streamChanges bool, outExt string) (skipProcessing bool) {
 	logger.Pl.I("Checking if processing should continue for file %q...", fd.OriginalVideoPath)
 
 	// Write thumbnail.
 	if abstractions.IsSet(keys.ForceWriteThumbnails) {
-		if abstractions.GetBool(keys.ForceWriteThumbnails) && fd.MWebData.Thumbnail != "" {
-			logger.Pl.I("Thumbnail URL detected. Will write to file.")
+		if abstractions.GetBool(keys.ForceWriteThumbnails) && fd.ThumbnailSource() != "" {
+			logger.Pl.I("Thumbnail detected. Will write to file.")
 			return false
 		}
 	}
 
-	var (
-		differentExt, codecsDiffer bool
-	)
+	var differentExt bool
 
 	// Check for extension difference.
 	currentExt := strings.ToLower(filepath.Ext(fd.OriginalVideoPath))
@@ -180,12 +208,7 @@ func skipProcessing(fd *models.FileData, currentVCodec, desiredVCodec, currentAC
 
 	logger.Pl.D(2, "Extension match check for file %q:\n\nCurrent extension: %q\nDesired extension: %q\n\nExtensions differ? %v", fd.OriginalVideoPath, currentExt, outExt, differentExt)
 
-	if desiredVCodec != "" || desiredACodec != "" {
-		if (desiredVCodec != currentVCodec && desiredVCodec != "") || (desiredACodec != currentACodec && desiredACodec != "") {
-			codecsDiffer = true
-		}
-		logger.Pl.D(2, "Codec check for %q:\n\nCurrent video codecs:\n\nVideo: %q\nAudio: %q\n\nDesired video codecs:\n\nVideo: %q\nAudio: %q\n\nCodecs differ? %v", fd.OriginalVideoPath, currentVCodec, currentACodec, desiredVCodec, desiredACodec, codecsDiffer)
-	}
+	logger.Pl.D(2, "Stream check for %q: streams need transcoding or dropping? %v", fd.OriginalVideoPath, streamChanges)
 
 	// Check if metadata already exists.
 	if !fd.MetaAlreadyExists {
@@ -193,7 +216,7 @@ func skipProcessing(fd *models.FileData, currentVCodec, desiredVCodec, currentAC
 	}
 
 	// Final checks.
-	if !codecsDiffer && !differentExt && fd.MetaAlreadyExists {
+	if !streamChanges && !differentExt && fd.MetaAlreadyExists {
 		// -- SKIP FURTHER PROCESSING. --
 		logger.Pl.I("For file %q, all metadata exists, codecs match, and extensions match. Skipping processing...", fd.OriginalVideoPath)
 
@@ -209,71 +232,25 @@ func skipProcessing(fd *models.FileData, currentVCodec, desiredVCodec, currentAC
 	return false
 }
 
-// makeBackup performs the backup.
-func makeBackup(origPath string) error {
-	origInfo, err := os.Stat(origPath)
-	if os.IsNotExist(err) {
-		logger.Pl.I("File does not exist, safe to proceed overwriting: %s", origPath)
-		return nil
+// runWithProgress runs an FFmpeg command, feeding its '-progress' output to the progress tracker.
+func runWithProgress(command *exec.Cmd, fd *models.FileData, stderr *bytes.Buffer) error {
+	var duration float64
+	if fd.Probe != nil {
+		duration = fd.Probe.DurationSeconds()
 	}
+	job := progress.Start(fd.OriginalVideoPath, duration)
+	defer job.Finish()
 
-	// Rename original to backup.
-	backupPath, err := file.RenameToBackup(origPath)
+	stdout, err := command.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("failed to rename original file and preserve file is on, aborting: %w", err)
+		return err
 	}
-
-	// Verify backup exists and matches size.
-	backInfo, err := os.Stat(backupPath)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("backup file %q was not created, aborting", backupPath)
-	}
-	if (origInfo != nil && backInfo != nil) && (origInfo.Size() != backInfo.Size()) {
-		return fmt.Errorf("backup file size %d does not match original %d, aborting", origInfo.Size(), backInfo.Size())
-	}
-
-	return nil
-}
-
-// checkCodecs checks the input codec to determine if a straight remux is possible.
-func checkCodecs(inputFile string) (videoCodec, audioCodec string, err error) {
-	if inputFile == "" {
-		return "", "", fmt.Errorf("input file is empty, cannot check codecs")
-	}
-
-	// FFprobe for video codec.
-	cmd := exec.Command("ffprobe",
-		"-v", "error",
-		"-select_streams", "v:0", // first video stream index is 0.
-		"-show_entries", "stream=codec_name",
-		"-of", "default=noprint_wrappers=1:nokey=1",
-		inputFile,
-	)
-
-	// Read video codec.
-	videoCodecBytes, err := cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("cannot read video codec: %w", err)
-	}
-	videoCodec = strings.TrimSpace(string(videoCodecBytes))
-
-	// FFprobe for audio codec.
-	cmd = exec.Command("ffprobe",
-		"-v", "error",
-		"-select_streams", "a:0", // first audio stream index is 0.
-		"-show_entries", "stream=codec_name",
-		"-of", "default=noprint_wrappers=1:nokey=1",
-		inputFile,
-	)
-
-	// Read audio codec.
-	audioCodecBytes, err := cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("cannot read audio codec: %w", err)
+	command.Stderr = stderr
+	if err := command.Start(); err != nil {
+		return err
 	}
-	audioCodec = strings.TrimSpace(string(audioCodecBytes))
 
-	// Log and return detected codecs.
-	logger.Pl.D(1, "Detected codecs - video: %s, audio: %s", videoCodec, audioCodec)
-	return videoCodec, audioCodec, nil
+	// Read until FFmpeg closes stdout, then reap the process.
+	job.Track(stdout)
+	return command.Wait()
 }
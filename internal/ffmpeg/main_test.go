@@ -0,0 +1,37 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"io"
+	"metarr/internal/domain/logger"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+// TestMain sets up a logger writing to a temporary directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "metarr-ffmpeg-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	pl, err := logging.SetupLogging(logging.LoggingConfig{
+		LogFilePath: filepath.Join(dir, "metarr.log"),
+		MaxSizeMB:   1,
+		Console:     io.Discard,
+		Program:     "Metarr",
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger.Pl = pl
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
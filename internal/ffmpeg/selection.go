@@ -0,0 +1,99 @@
+package ffmpeg
+
+import (
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/models"
+	"slices"
+	"strings"
+)
+
+// streamSelection holds the user's rules for keeping or dropping audio and subtitle streams.
+type streamSelection struct {
+	audioLangs       []string
+	subtitleLangs    []string
+	dropTypes        []string
+	dropDispositions []string
+	forcedSubsOnly   bool
+}
+
+// loadStreamSelection reads the stream selection rules from config.
+func loadStreamSelection() streamSelection {
+	return streamSelection{
+		audioLangs:       abstractions.GetStringSlice(keys.AudioLanguages),
+		subtitleLangs:    abstractions.GetStringSlice(keys.SubtitleLanguages),
+		dropTypes:        abstractions.GetStringSlice(keys.DropStreamTypes),
+		dropDispositions: abstractions.GetStringSlice(keys.DropDispositions),
+		forcedSubsOnly:   abstractions.GetBool(keys.ForcedSubtitlesOnly),
+	}
+}
+
+// dropped returns the input indices of streams removed by the selection rules, with the reason for each.
+//
+// If the rules would remove every audio stream, all audio is kept instead (unless audio is dropped by type).
+func (sel streamSelection) dropped(probe *models.ProbeData) map[int]string {
+	drops := make(map[int]string)
+
+	audioTotal, audioDropped := 0, 0
+	for _, s := range probe.Streams {
+		if s.CodecType == models.StreamAudio {
+			audioTotal++
+		}
+		if reason := sel.dropReason(&s); reason != "" {
+			drops[s.Index] = reason
+			if s.CodecType == models.StreamAudio {
+				audioDropped++
+			}
+		}
+	}
+
+	if audioTotal > 0 && audioDropped == audioTotal && !slices.Contains(sel.dropTypes, models.StreamAudio) {
+		logger.Pl.W("No audio stream matches the stream selection rules, keeping all %d audio streams", audioTotal)
+		for _, s := range probe.Streams {
+			if s.CodecType == models.StreamAudio {
+				delete(drops, s.Index)
+			}
+		}
+	}
+	return drops
+}
+
+// dropReason returns why a stream should be dropped, or an empty string to keep it.
+func (sel streamSelection) dropReason(s *models.ProbeStream) string {
+	if s.CodecType == models.StreamVideo {
+		return ""
+	}
+	if slices.Contains(sel.dropTypes, s.CodecType) {
+		return "stream type " + s.CodecType
+	}
+	if s.CodecType != models.StreamAudio && s.CodecType != models.StreamSubtitle {
+		return ""
+	}
+
+	// Dispositions (titles mentioning commentary count as 'comment').
+	for _, d := range sel.dropDispositions {
+		if s.HasDisposition(d) || (d == "comment" && strings.Contains(strings.ToLower(s.Title()), "commentary")) {
+			return "disposition " + d
+		}
+	}
+
+	// Languages.
+	langs := sel.audioLangs
+	if s.CodecType == models.StreamSubtitle {
+		if sel.forcedSubsOnly && !s.HasDisposition("forced") {
+			return "not forced"
+		}
+		langs = sel.subtitleLangs
+	}
+	if len(langs) > 0 {
+		lang := strings.ToLower(s.Language())
+		if lang == "" {
+			lang = "und"
+		}
+		if !slices.Contains(langs, lang) {
+			return "language " + lang
+		}
+	}
+	return ""
+}
@@ -0,0 +1,431 @@
+package ffmpeg
+
+import (
+	"context"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/models"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// availableCodecsCache caches the codecs in FFmpeg to avoid repeated calls.
+var (
+	availableCodecsCache     string
+	availableCodecsCacheOnce sync.Once
+)
+
+// Text-based subtitle codecs which can be converted between containers.
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+// matroskaTextSubtitleCodecs are the text subtitle codecs Matroska can hold as they are.
+var matroskaTextSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "text"}
+
+// streamPlan is the output decision for a single input stream.
+type streamPlan struct {
+	input       int    // FFmpeg input number (0 is the video, subtitle sidecars follow).
+	sidecar     string // Path of the subtitle sidecar for inputs above 0.
+	language    string // Language tag to set on the output stream (empty to leave as is).
+	inIndex     int    // Stream index in the input file.
+	codecType   string // Stream type (e.g. models.StreamAudio).
+	outIndex    int    // Index among output streams of the same type.
+	inCodec     string // Codec reported by FFprobe.
+	want        string // Codec expected in the output (input codec when copied).
+	encoder     string // FFmpeg encoder, or "copy".
+	rate        string // Audio sample rate required by the encoder (empty if unchanged).
+	gpu         bool   // Encoded with a hardware encoder.
+	attachedPic bool   // Stream is embedded cover art.
+}
+
+// streamPlanner decides the codec for each input stream based on the codec maps and output container.
+type streamPlanner struct {
+	inExt, outExt        string
+	accelType            string
+	availableCodecs      string
+	dropPics             bool // Existing cover art is being stripped or replaced.
+	dropImageAttachments bool // New cover art is being attached as an MKV attachment.
+	selection            streamSelection
+	selectionDrops       int                      // Streams removed by the selection rules in the last plan.
+	sidecars             []models.SubtitleSidecar // External subtitle files to mux in.
+	sidecarsMuxed        int                      // Sidecars added as inputs in the last plan.
+	sidecarsDone         []string                 // Sidecars muxed or already present in the last plan.
+}
+
+// newStreamPlanner creates a stream planner for an input file and output extension.
+func newStreamPlanner(ctx context.Context, inputFile, outExt, accelType string) *streamPlanner {
+	return &streamPlanner{
+		inExt:           strings.ToLower(filepath.Ext(inputFile)),
+		outExt:          strings.ToLower(outExt),
+		accelType:       accelType,
+		availableCodecs: ffmpegAvailableCodecs(ctx),
+		selection:       loadStreamSelection(),
+	}
+}
+
+// plan returns the output decision for every stream which will be kept, in input order.
+func (p *streamPlanner) plan(probe *models.ProbeData) []streamPlan {
+	counts := make(map[string]int)
+	plans := make([]streamPlan, 0, len(probe.Streams))
+	drops := p.selection.dropped(probe)
+	p.selectionDrops = len(drops)
+
+	for _, s := range probe.Streams {
+		if reason, drop := drops[s.Index]; drop {
+			logger.Pl.D(1, "Dropping %s stream %d (%s)", s.CodecType, s.Index, reason)
+			continue
+		}
+		sp, keep := p.planStream(&s)
+		if !keep {
+			continue
+		}
+		sp.inIndex = s.Index
+		sp.codecType = s.CodecType
+		sp.inCodec = s.CodecName
+		sp.attachedPic = s.IsAttachedPic()
+		if sp.want == "" {
+			sp.want = s.CodecName
+		}
+		sp.outIndex = counts[s.CodecType]
+		counts[s.CodecType]++
+
+		logger.Pl.D(1, "Stream %d (%s %q) → %s:%d using %q", sp.inIndex, sp.codecType, sp.inCodec, streamSpecifier(sp.codecType), sp.outIndex, sp.encoder)
+		plans = append(plans, sp)
+	}
+
+	// Subtitle sidecars, skipping languages the video already has.
+	p.sidecarsMuxed, p.sidecarsDone = 0, nil
+	existing := make(map[string]bool)
+	for _, s := range probe.StreamsOfType(models.StreamSubtitle) {
+		existing[strings.ToLower(s.Language())] = true
+	}
+
+	for _, sc := range p.sidecars {
+		if existing[sc.Language] {
+			logger.Pl.D(1, "Video already has a %q subtitle stream, not muxing %q", sc.Language, sc.Path)
+			p.sidecarsDone = append(p.sidecarsDone, sc.Path)
+			continue
+		}
+		sp, keep := p.sidecarPlan(sc)
+		if !keep {
+			continue
+		}
+		sp.input = p.sidecarsMuxed + 1
+		sp.outIndex = counts[models.StreamSubtitle]
+		counts[models.StreamSubtitle]++
+		p.sidecarsMuxed++
+		p.sidecarsDone = append(p.sidecarsDone, sc.Path)
+
+		logger.Pl.D(1, "Subtitle file %q → s:%d using %q", sc.Path, sp.outIndex, sp.encoder)
+		plans = append(plans, sp)
+	}
+	return plans
+}
+
+// sidecarPlan converts an external subtitle file to a format the output container supports.
+func (p *streamPlanner) sidecarPlan(sc models.SubtitleSidecar) (streamPlan, bool) {
+	// Selection rules apply to sidecars as to embedded streams.
+	s := models.ProbeStream{
+		CodecType: models.StreamSubtitle,
+		CodecName: sc.Codec,
+		Tags:      models.ProbeTags{"language": sc.Language},
+	}
+	if reason := p.selection.dropReason(&s); reason != "" {
+		logger.Pl.D(1, "Not muxing subtitle file %q (%s)", sc.Path, reason)
+		return streamPlan{}, false
+	}
+
+	var encoder string
+	switch p.outExt {
+	case sharedconsts.ExtMKV:
+		encoder = sharedconsts.VCodecCopy
+		if sc.Codec == "webvtt" {
+			encoder = "subrip" // Wider player support than WebVTT in Matroska.
+		}
+	case sharedconsts.ExtMP4, sharedconsts.ExtM4V, sharedconsts.ExtMOV:
+		encoder = "mov_text"
+	case sharedconsts.ExtWEBM:
+		encoder = "webvtt"
+	default:
+		logger.Pl.W("Not muxing subtitle file %q, subtitles not supported in %q containers", sc.Path, p.outExt)
+		return streamPlan{}, false
+	}
+
+	sp := streamPlan{
+		sidecar:   sc.Path,
+		language:  sc.Language,
+		codecType: models.StreamSubtitle,
+		inCodec:   sc.Codec,
+		want:      sc.Codec,
+		encoder:   encoder,
+	}
+	if encoder != sharedconsts.VCodecCopy {
+		sp.want = encoder
+	}
+	return sp, true
+}
+
+// planStream returns the decision for a single stream, or false if the stream should be dropped.
+func (p *streamPlanner) planStream(s *models.ProbeStream) (streamPlan, bool) {
+	copyPlan := streamPlan{encoder: sharedconsts.VCodecCopy}
+
+	switch s.CodecType {
+	case models.StreamVideo:
+		if s.IsAttachedPic() {
+			if p.dropPics || !supportsCoverArt(p.outExt) {
+				logger.Pl.D(1, "Not keeping existing cover art stream %d", s.Index)
+				return streamPlan{}, false
+			}
+			return copyPlan, true
+		}
+		return p.videoPlan(s.CodecName), true
+
+	case models.StreamAudio:
+		return p.audioPlan(s.CodecName), true
+
+	case models.StreamSubtitle:
+		return p.subtitlePlan(s)
+
+	case models.StreamData:
+		// Data streams (e.g. timecodes) rarely survive a container change.
+		if p.inExt != p.outExt {
+			logger.Pl.D(1, "Dropping data stream %d, not supported when changing container to %q", s.Index, p.outExt)
+			return streamPlan{}, false
+		}
+		return copyPlan, true
+
+	case models.StreamAttachment:
+		if p.outExt != sharedconsts.ExtMKV {
+			logger.Pl.D(1, "Dropping attachment stream %d, only supported in MKV", s.Index)
+			return streamPlan{}, false
+		}
+		if p.dropImageAttachments && strings.HasPrefix(s.Tags.Get("mimetype"), "image/") {
+			logger.Pl.D(1, "Dropping image attachment %d, replaced by new thumbnail", s.Index)
+			return streamPlan{}, false
+		}
+		return copyPlan, true
+	}
+
+	logger.Pl.D(1, "Dropping stream %d of unknown type %q", s.Index, s.CodecType)
+	return streamPlan{}, false
+}
+
+// videoPlan applies the video codec map to a single video stream.
+func (p *streamPlanner) videoPlan(inCodec string) streamPlan {
+	copyPlan := streamPlan{encoder: sharedconsts.VCodecCopy}
+
+	desired := getOutputVideoCodecString(inCodec)
+	if slices.Contains(consts.IncompatibleCodecsForContainer[p.outExt], desired) {
+		logger.Pl.I("Desired codec %q is not compatible with video container %q, falling back to 'copy'.", desired, p.outExt)
+		return copyPlan
+	}
+	if desired == "" || desired == sharedconsts.VCodecCopy || codecMatches(desired, inCodec) {
+		return copyPlan
+	}
+
+	// Hardware encoder '<codec>_<accelerator>'.
+	if p.accelType != "" && p.accelType != sharedconsts.AccelTypeAuto {
+		accel := p.accelType
+		if accel == sharedconsts.AccelTypeCuda {
+			accel = consts.AccelFlagNvenc
+		}
+		gpuCodec := desired + "_" + accel
+		if strings.Contains(p.availableCodecs, gpuCodec) {
+			return streamPlan{want: desired, encoder: gpuCodec, gpu: true}
+		}
+		logger.Pl.W("GPU-bound video codec %q not available in FFmpeg build, falling back to software.", gpuCodec)
+	}
+
+	// Software encoder.
+	encoder, exists := consts.VCodecToFFVCodec[desired]
+	if !exists {
+		return copyPlan
+	}
+	if !strings.Contains(p.availableCodecs, encoder) {
+		logger.Pl.W("Video codec %q not available in FFmpeg build, copying stream.", encoder)
+		return copyPlan
+	}
+	return streamPlan{want: desired, encoder: encoder}
+}
+
+// audioPlan applies the audio codec map to a single audio stream.
+func (p *streamPlanner) audioPlan(inCodec string) streamPlan {
+	copyPlan := streamPlan{encoder: sharedconsts.ACodecCopy}
+
+	desired := getOutputAudioCodecString(inCodec)
+	if desired == "" || desired == sharedconsts.ACodecCopy || codecMatches(desired, inCodec) {
+		return copyPlan
+	}
+
+	sp := streamPlan{want: desired, encoder: desired}
+	switch desired {
+	case sharedconsts.ACodecAAC, // -- No audio rate needed. --
+		sharedconsts.ACodecALAC,
+		sharedconsts.ACodecFLAC,
+		sharedconsts.ACodecMP2,
+		sharedconsts.ACodecMP3,
+		sharedconsts.ACodecOpus,
+		sharedconsts.ACodecVorbis,
+		sharedconsts.ACodecTrueHD:
+
+	case sharedconsts.ACodecAC3, // -- 48KHz audio rate required. --
+		sharedconsts.ACodecDTS,
+		sharedconsts.ACodecEAC3:
+		sp.rate = consts.AudioRate48khz
+
+	case sharedconsts.ACodecPCM, sharedconsts.ACodecWAV:
+		sp.encoder = "pcm_s16le"
+
+	default: // -- Invalid or un-set codec. --
+		return copyPlan
+	}
+
+	// Check codec availability.
+	if !strings.Contains(p.availableCodecs, sp.encoder) {
+		logger.Pl.W("Audio codec %q not available in FFmpeg build, copying stream.", sp.encoder)
+		return copyPlan
+	}
+	return sp
+}
+
+// subtitlePlan keeps subtitles where the output container can hold them, converting text formats if needed.
+func (p *streamPlanner) subtitlePlan(s *models.ProbeStream) (streamPlan, bool) {
+	isText := slices.Contains(textSubtitleCodecs, s.CodecName)
+
+	var encoder string
+	switch p.outExt {
+	case sharedconsts.ExtMKV:
+		encoder = sharedconsts.VCodecCopy
+		if isText && !slices.Contains(matroskaTextSubtitleCodecs, s.CodecName) {
+			encoder = "subrip" // E.g. MP4 'mov_text', which Matroska can't hold.
+		}
+
+	case sharedconsts.ExtMP4, sharedconsts.ExtM4V, sharedconsts.ExtMOV:
+		switch {
+		case s.CodecName == "mov_text", s.CodecName == "dvd_subtitle":
+			encoder = sharedconsts.VCodecCopy
+		case isText:
+			encoder = "mov_text"
+		}
+
+	case sharedconsts.ExtWEBM:
+		switch {
+		case s.CodecName == "webvtt":
+			encoder = sharedconsts.VCodecCopy
+		case isText:
+			encoder = "webvtt"
+		}
+
+	default:
+		if p.inExt == p.outExt {
+			encoder = sharedconsts.VCodecCopy
+		}
+	}
+
+	if encoder == "" {
+		logger.Pl.W("Dropping subtitle stream %d (%q), not supported in %q containers", s.Index, s.CodecName, p.outExt)
+		return streamPlan{}, false
+	}
+	if encoder == sharedconsts.VCodecCopy {
+		return streamPlan{encoder: encoder}, true
+	}
+	return streamPlan{want: encoder, encoder: encoder}, true
+}
+
+// streamArgs returns the '-map' and per-stream codec arguments for the planned streams.
+func streamArgs(plans []streamPlan, outExt string, accelCompatibility []string) []string {
+	args := make([]string, 0, len(plans)*4)
+	for _, sp := range plans {
+		args = append(args, "-map", strconv.Itoa(sp.input)+":"+strconv.Itoa(sp.inIndex))
+	}
+
+	for _, sp := range plans {
+		spec := streamSpecifier(sp.codecType) + ":" + strconv.Itoa(sp.outIndex)
+		args = append(args, "-c:"+spec, sp.encoder)
+
+		if sp.rate != "" {
+			args = append(args, "-ar:"+spec, sp.rate)
+		}
+		if sp.gpu && len(accelCompatibility) > 0 {
+			args = append(args, "-filter:"+spec)
+			args = append(args, accelCompatibility...)
+		}
+		if sp.attachedPic && supportsAttachedPicDisposition(outExt) {
+			args = append(args, "-disposition:"+spec, "attached_pic")
+		}
+		if sp.language != "" {
+			args = append(args, "-metadata:s:"+spec, "language="+sp.language)
+		}
+	}
+	return args
+}
+
+// needsTranscode returns true if any video or audio stream will be re-encoded.
+func needsTranscode(plans []streamPlan) bool {
+	for _, sp := range plans {
+		if (sp.codecType == models.StreamVideo || sp.codecType == models.StreamAudio) && sp.encoder != sharedconsts.VCodecCopy {
+			return true
+		}
+	}
+	return false
+}
+
+// countPlanned returns the number of planned output streams of a type.
+func countPlanned(plans []streamPlan, codecType string) int {
+	n := 0
+	for _, sp := range plans {
+		if sp.codecType == codecType {
+			n++
+		}
+	}
+	return n
+}
+
+// streamSpecifier returns the FFmpeg stream specifier letter for a stream type.
+func streamSpecifier(codecType string) string {
+	switch codecType {
+	case models.StreamVideo:
+		return "v"
+	case models.StreamAudio:
+		return "a"
+	case models.StreamSubtitle:
+		return "s"
+	case models.StreamData:
+		return "d"
+	case models.StreamAttachment:
+		return "t"
+	}
+	return codecType
+}
+
+// supportsCoverArt returns true if cover art streams can be kept in the container.
+func supportsCoverArt(ext string) bool {
+	return supportsAttachedPicDisposition(ext) || ext == sharedconsts.ExtMKV
+}
+
+// supportsAttachedPicDisposition returns true if the container stores cover art as an 'attached_pic' video stream.
+func supportsAttachedPicDisposition(ext string) bool {
+	switch ext {
+	case sharedconsts.ExtMP4, sharedconsts.ExtM4V, sharedconsts.ExtMOV:
+		return true
+	}
+	return false
+}
+
+// ffmpegAvailableCodecs lists encoders available in FFmpeg (cached after the first call).
+func ffmpegAvailableCodecs(ctx context.Context) string {
+	availableCodecsCacheOnce.Do(func() {
+		outBytes, err := exec.CommandContext(ctx, "ffmpeg", "-encoders").Output()
+		if err != nil {
+			logger.Pl.E("Codec Grab Failed: %v", err)
+			return
+		}
+		availableCodecsCache = strings.TrimSpace(string(outBytes))
+	})
+	return availableCodecsCache
+}
@@ -0,0 +1,35 @@
+package ffmpeg
+
+import (
+	"metarr/internal/models"
+	"testing"
+)
+
+func TestSubtitlePlan(t *testing.T) {
+	tests := []struct {
+		inExt, outExt string
+		codec         string
+		wantKeep      bool
+		wantEncoder   string
+	}{
+		{".mp4", ".mkv", "mov_text", true, "subrip"},
+		{".mkv", ".mkv", "subrip", true, "copy"},
+		{".mkv", ".mkv", "ass", true, "copy"},
+		{".webm", ".mkv", "webvtt", true, "copy"},
+		{".mkv", ".mkv", "hdmv_pgs_subtitle", true, "copy"},
+		{".mkv", ".mp4", "subrip", true, "mov_text"},
+		{".mp4", ".mp4", "mov_text", true, "copy"},
+		{".mkv", ".mp4", "hdmv_pgs_subtitle", false, ""},
+		{".mp4", ".webm", "mov_text", true, "webvtt"},
+		{".mkv", ".webm", "dvd_subtitle", false, ""},
+		{".avi", ".avi", "xsub", true, "copy"},
+		{".mkv", ".avi", "subrip", false, ""},
+	}
+	for _, tt := range tests {
+		p := &streamPlanner{inExt: tt.inExt, outExt: tt.outExt}
+		sp, keep := p.subtitlePlan(&models.ProbeStream{CodecType: models.StreamSubtitle, CodecName: tt.codec})
+		if keep != tt.wantKeep || sp.encoder != tt.wantEncoder {
+			t.Errorf("%s %s → %s: got (%q, %v), want (%q, %v)", tt.codec, tt.inExt, tt.outExt, sp.encoder, keep, tt.wantEncoder, tt.wantKeep)
+		}
+	}
+}
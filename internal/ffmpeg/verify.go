@@ -0,0 +1,119 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/ffprobe"
+	"metarr/internal/models"
+	"os/exec"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// verifyOutput probes FFmpeg's output and compares it with the input, returning an error if it looks broken.
+func verifyOutput(ctx context.Context, fd *models.FileData, outPath string, plans []streamPlan) error {
+	if !abstractions.GetBool(keys.VerifyOutput) {
+		return nil
+	}
+	logger.Pl.I("Verifying FFmpeg output %q...", outPath)
+
+	in, err := ffprobe.Probe(ctx, fd)
+	if err != nil {
+		return fmt.Errorf("could not probe input: %w", err)
+	}
+	out, err := ffprobe.ProbeFile(ctx, outPath)
+	if err != nil {
+		return fmt.Errorf("could not probe output: %w", err)
+	}
+
+	// Duration.
+	if inDur := in.DurationSeconds(); inDur > 0 {
+		outDur := out.DurationSeconds()
+		if outDur <= 0 {
+			return fmt.Errorf("output has no duration (input is %.2fs)", inDur)
+		}
+		if tolerance := abstractions.GetFloat64(keys.VerifyDurationTolerance); math.Abs(inDur-outDur) > tolerance {
+			return fmt.Errorf("output duration %.2fs differs from input %.2fs by more than %.2fs", outDur, inDur, tolerance)
+		}
+	}
+
+	// Video stream presence.
+	hasVideo := false
+	for _, s := range out.StreamsOfType(models.StreamVideo) {
+		if s.Width > 0 && s.Height > 0 {
+			hasVideo = true
+			break
+		}
+	}
+	if !hasVideo {
+		return fmt.Errorf("output has no usable video stream")
+	}
+
+	// Stream counts and codecs, per planned stream (cover art excluded).
+	for _, codecType := range []string{models.StreamVideo, models.StreamAudio, models.StreamSubtitle} {
+		outStreams := out.StreamsOfType(codecType)
+
+		k := 0
+		for _, sp := range plans {
+			if sp.codecType != codecType || sp.attachedPic {
+				continue
+			}
+			if k >= len(outStreams) {
+				return fmt.Errorf("output is missing %s stream %d (input stream %d)", codecType, k, sp.inIndex)
+			}
+			if got := outStreams[k].CodecName; !codecMatches(sp.want, got) {
+				return fmt.Errorf("output %s stream %d codec is %q, expected %q", codecType, k, got, sp.want)
+			}
+			k++
+		}
+	}
+
+	// Full decode.
+	if abstractions.GetBool(keys.VerifyDecode) {
+		if err := decodeFile(ctx, outPath); err != nil {
+			return err
+		}
+	}
+
+	logger.Pl.S("Verified FFmpeg output %q", outPath)
+	return nil
+}
+
+// decodeFile fully decodes a file, failing on the first decode error.
+func decodeFile(ctx context.Context, path string) error {
+	logger.Pl.I("Running full decode pass on %q...", path)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-xerror",
+		"-i", path,
+		"-f", "null", "-",
+	)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("decode pass failed: %w\n\nCaptured output:\n%s", err, stderr.String())
+	}
+	if s := strings.TrimSpace(stderr.String()); s != "" {
+		return fmt.Errorf("decode pass reported errors:\n%s", s)
+	}
+	return nil
+}
+
+// codecMatches checks an FFprobe codec name against a Metarr codec name (e.g. "mpeg2" matches "mpeg2video").
+func codecMatches(want, got string) bool {
+	if want == "" || want == sharedconsts.VCodecCopy {
+		return true
+	}
+	if want == sharedconsts.ACodecWAV {
+		want = sharedconsts.ACodecPCM
+	}
+	return strings.HasPrefix(strings.ToLower(got), want)
+}
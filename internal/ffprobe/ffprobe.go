@@ -2,13 +2,11 @@ package ffprobe
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"metarr/internal/abstractions"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/models"
-	"os/exec"
 
 	"github.com/TubarrApp/gocommon/logging"
 )
@@ -22,37 +20,20 @@ type tagDiffMap map[string]tagDiff
 
 // CheckMetaMatches checks FFprobe captured metadata from the video against the metafile.
 func CheckMetaMatches(ctx context.Context, extension string, fd *models.FileData) (allMetaMatches bool) {
-	command := exec.CommandContext(
-		ctx,
-		"ffprobe",
-		"-v", "quiet",
-		"-print_format", "json",
-		"-show_format", "-show_streams",
-		fd.OriginalVideoPath,
-	)
-
-	logger.Pl.I("Made command for FFprobe:\n\n%v", command.String())
-	output, err := command.Output()
+	ffData, err := Probe(ctx, fd)
 	if err != nil {
 		logger.Pl.E("Error running FFprobe command: %v. Will not process video.", err)
 		return false
 	}
 
-	// Parse JSON output.
-	var ffData ffprobeOutput
-	if err := json.Unmarshal(output, &ffData); err != nil {
-		logger.Pl.E("Error parsing FFprobe output: %v. Will not process video.", err)
-		return false
-	}
-
 	// Check if thumbnail is already present in file.
 	for _, s := range ffData.Streams {
-		if s.Disposition.AttachedPic == 1 && s.CodecType == "video" {
+		if s.IsAttachedPic() {
 			logger.Pl.I("Video %q has an embedded thumbnail", fd.OriginalVideoPath)
 			fd.HasEmbeddedThumbnail = true
 
 			// Thumbnail embedded in file, missing in metafile.
-			if fd.MWebData.Thumbnail == "" {
+			if fd.ThumbnailSource() == "" {
 				return false
 			}
 			break
@@ -71,14 +52,14 @@ func CheckMetaMatches(ctx context.Context, extension string, fd *models.FileData
 		return false
 	}
 
-	// No thumbnail in file but thumbnail exists in metadata.
-	if !fd.HasEmbeddedThumbnail && fd.MWebData.Thumbnail != "" {
-		logger.Pl.I("No thumbnail in video %q, found thumbnail %q", fd.OriginalVideoPath, fd.MWebData.Thumbnail)
+	// No thumbnail in file but thumbnail exists in metadata or beside the video.
+	if !fd.HasEmbeddedThumbnail && fd.ThumbnailSource() != "" {
+		logger.Pl.I("No thumbnail in video %q, found thumbnail %q", fd.OriginalVideoPath, fd.ThumbnailSource())
 		return false
 	}
 
 	// Map of metadata to check.
-	metaCheckMap, exists := getDiffMapForFiletype(extension, fd, ffData)
+	metaCheckMap, exists := getDiffMapForFiletype(extension, fd, ffData.Format.Tags)
 	if !exists {
 		logger.Pl.W("FFprobe metadata key map not available for filetype %s", extension)
 		return false
@@ -12,33 +12,8 @@ import (
 	"github.com/TubarrApp/gocommon/sharedtags"
 )
 
-// ffprobeFormat contains metadata tags.
-type ffprobeFormat struct {
-	Tags ffprobeTags `json:"tags"`
-}
-
-// ffprobeOutput contains top-level FFprobe output.
-type ffprobeOutput struct {
-	Streams []ffprobeStream `json:"streams"`
-	Format  ffprobeFormat   `json:"format"`
-}
-
-// ffprobeTags is a map of metadata key-value pairs.
-//
-// Different container formats use different key names (e.g., "artist" vs "ARTIST" vs "WM/AlbumArtist").
-type ffprobeTags map[string]string
-
-type ffprobeStream struct {
-	Index       int    `json:"index"`
-	CodecType   string `json:"codec_type"`
-	CodecName   string `json:"codec_name"`
-	Disposition struct {
-		AttachedPic int `json:"attached_pic"`
-	} `json:"disposition"`
-}
-
 // getDiffMapForFiletype returns a struct map with values.
-func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput) (tagMap tagDiffMap, exists bool) {
+func getDiffMapForFiletype(e string, fd *models.FileData, tags models.ProbeTags) (tagMap tagDiffMap, exists bool) {
 	switch e {
 	// ASF.
 	case sharedconsts.ExtASF,
@@ -46,39 +21,39 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 
 		return tagDiffMap{
 			sharedtags.ASFArtist: { // FFprobe access key.
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFArtist)), // FFprobe value. Do not remove "get", keys are hard to predict.
-				new:      strings.TrimSpace(fd.MCredits.Artist),                           // Desired new value.
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFArtist)), // FFprobe value. Do not remove "Get", keys are hard to predict.
+				new:      strings.TrimSpace(fd.MCredits.Artist),             // Desired new value.
 			},
 			sharedtags.ASFComposer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFComposer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFComposer)),
 				new:      strings.TrimSpace(fd.MCredits.Composer),
 			},
 			sharedtags.ASFDirector: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFDirector)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFDirector)),
 				new:      strings.TrimSpace(fd.MCredits.Director),
 			},
 			sharedtags.ASFEncodingTime: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.ASFEncodingTime)),
+				existing: getDatePart(tags.Get(sharedtags.ASFEncodingTime)),
 				new:      getDatePart(fd.MDates.Date),
 			},
 			sharedtags.ASFProducer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFProducer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFProducer)),
 				new:      strings.TrimSpace(fd.MCredits.Producer),
 			},
 			sharedtags.ASFSubtitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFSubtitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFSubtitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Subtitle),
 			},
 			sharedtags.ASFSubTitleDescription: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFSubTitleDescription)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFSubTitleDescription)),
 				new:      strings.TrimSpace(fd.MTitleDesc.LongDescription),
 			},
 			sharedtags.ASFTitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ASFTitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ASFTitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 			sharedtags.ASFYear: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.ASFYear)),
+				existing: getDatePart(tags.Get(sharedtags.ASFYear)),
 				new:      getDatePart(fd.MDates.Year),
 			},
 		}, true
@@ -87,39 +62,39 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 	case sharedconsts.ExtAVI:
 		return tagDiffMap{
 			sharedtags.AVIArtist: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVIArtist)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVIArtist)),
 				new:      strings.TrimSpace(fd.MCredits.Artist),
 			},
 			sharedtags.AVIComment: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVIComment)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVIComment)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Description),
 			},
 			sharedtags.AVIComments: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVIComments)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVIComments)),
 				new:      strings.TrimSpace(fd.MTitleDesc.LongDescription),
 			},
 			sharedtags.AVIDateCreated: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.AVIDateCreated)),
+				existing: getDatePart(tags.Get(sharedtags.AVIDateCreated)),
 				new:      getDatePart(fd.MDates.ReleaseDate),
 			},
 			sharedtags.AVIEngineer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVIEngineer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVIEngineer)),
 				new:      strings.TrimSpace(fd.MCredits.Producer),
 			},
 			sharedtags.AVIStar: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVIStar)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVIStar)),
 				new:      strings.TrimSpace(fd.MCredits.Actor),
 			},
 			sharedtags.AVISubject: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVISubject)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVISubject)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Synopsis),
 			},
 			sharedtags.AVITitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.AVITitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.AVITitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 			sharedtags.AVIYear: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.AVIYear)),
+				existing: getDatePart(tags.Get(sharedtags.AVIYear)),
 				new:      getDatePart(fd.MDates.Year),
 			},
 		}, true
@@ -128,7 +103,7 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 	case sharedconsts.ExtFLV:
 		return tagDiffMap{
 			sharedtags.FLVCreationDate: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.FLVCreationDate)),
+				existing: getDatePart(tags.Get(sharedtags.FLVCreationDate)),
 				new:      getDatePart(fd.MDates.Date),
 			},
 		}, true
@@ -143,35 +118,35 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 
 		return tagDiffMap{
 			sharedtags.ISOArtist: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISOArtist)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISOArtist)),
 				new:      strings.TrimSpace(fd.MCredits.Artist),
 			},
 			sharedtags.ISOComment: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISOComment)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISOComment)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Comment),
 			},
 			sharedtags.ISOComposer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISOComposer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISOComposer)),
 				new:      strings.TrimSpace(fd.MCredits.Composer),
 			},
 			sharedtags.ISOCreationTime: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.ISOCreationTime)),
+				existing: getDatePart(tags.Get(sharedtags.ISOCreationTime)),
 				new:      getDatePart(fd.MDates.CreationTime),
 			},
 			sharedtags.JDate: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.ISODate)),
+				existing: getDatePart(tags.Get(sharedtags.ISODate)),
 				new:      getDatePart(fd.MDates.Date),
 			},
 			sharedtags.ISODescription: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISODescription)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISODescription)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Description),
 			},
 			sharedtags.ISOSynopsis: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISOSynopsis)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISOSynopsis)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Synopsis),
 			},
 			sharedtags.ISOTitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.ISOTitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.ISOTitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 		}, true
@@ -182,55 +157,55 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 
 		return tagDiffMap{
 			sharedtags.MatroskaArtist: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaArtist)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaArtist)),
 				new:      strings.TrimSpace(fd.MCredits.Artist),
 			},
 			sharedtags.MatroskaComposer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaComposer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaComposer)),
 				new:      strings.TrimSpace(fd.MCredits.Composer),
 			},
 			sharedtags.MatroskaDateEncoded: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.MatroskaDateEncoded)),
+				existing: getDatePart(tags.Get(sharedtags.MatroskaDateEncoded)),
 				new:      getDatePart(fd.MDates.CreationTime),
 			},
 			sharedtags.MatroskaDateReleased: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.MatroskaDateReleased)),
+				existing: getDatePart(tags.Get(sharedtags.MatroskaDateReleased)),
 				new:      getDatePart(fd.MDates.ReleaseDate),
 			},
 			sharedtags.MatroskaDescription: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaDescription)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaDescription)),
 				new:      strings.TrimSpace(fd.MTitleDesc.LongDescription),
 			},
 			sharedtags.MatroskaDirector: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaDirector)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaDirector)),
 				new:      strings.TrimSpace(fd.MCredits.Director),
 			},
 			sharedtags.MatroskaLeadPerformer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaLeadPerformer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaLeadPerformer)),
 				new:      strings.TrimSpace(fd.MCredits.Actor),
 			},
 			sharedtags.MatroskaPerformer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaPerformer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaPerformer)),
 				new:      strings.TrimSpace(fd.MCredits.Performer),
 			},
 			sharedtags.MatroskaProducer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaProducer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaProducer)),
 				new:      strings.TrimSpace(fd.MCredits.Producer),
 			},
 			sharedtags.MatroskaSubject: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaSubject)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaSubject)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Subtitle),
 			},
 			sharedtags.MatroskaSummary: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaSummary)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaSummary)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Summary),
 			},
 			sharedtags.MatroskaSynopsis: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaSynopsis)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaSynopsis)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Synopsis),
 			},
 			sharedtags.MatroskaTitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.MatroskaTitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.MatroskaTitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 		}, true
@@ -240,11 +215,11 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 		sharedconsts.ExtTS:
 		return tagDiffMap{
 			sharedtags.TSServiceName: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.TSServiceName)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.TSServiceName)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 			sharedtags.TSServiceProvider: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.TSServiceProvider)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.TSServiceProvider)),
 				new:      strings.TrimSpace(fd.MCredits.Artist),
 			},
 		}, true
@@ -255,31 +230,31 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 
 		return tagDiffMap{
 			sharedtags.OggArtist: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggArtist)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggArtist)),
 				new:      strings.TrimSpace(fd.MCredits.Artist),
 			},
 			sharedtags.OggComposer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggComposer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggComposer)),
 				new:      strings.TrimSpace(fd.MCredits.Composer),
 			},
 			sharedtags.OggDate: {
-				existing: getDatePart(ffData.Format.Tags.get(sharedtags.OggDate)),
+				existing: getDatePart(tags.Get(sharedtags.OggDate)),
 				new:      getDatePart(fd.MDates.Date),
 			},
 			sharedtags.OggDescription: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggDescription)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggDescription)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Description),
 			},
 			sharedtags.OggPerformer: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggPerformer)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggPerformer)),
 				new:      strings.TrimSpace(fd.MCredits.Performer),
 			},
 			sharedtags.OggSummary: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggSummary)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggSummary)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Summary),
 			},
 			sharedtags.OggTitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.OggTitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.OggTitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 		}, true
@@ -289,15 +264,15 @@ func getDiffMapForFiletype(e string, fd *models.FileData, ffData ffprobeOutput)
 		sharedconsts.ExtRMVB:
 		return tagDiffMap{
 			sharedtags.RMAuthor: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.RMAuthor)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.RMAuthor)),
 				new:      strings.TrimSpace(fd.MCredits.Author),
 			},
 			sharedtags.RMComment: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.RMComment)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.RMComment)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Description),
 			},
 			sharedtags.RMTitle: {
-				existing: strings.TrimSpace(ffData.Format.Tags.get(sharedtags.RMTitle)),
+				existing: strings.TrimSpace(tags.Get(sharedtags.RMTitle)),
 				new:      strings.TrimSpace(fd.MTitleDesc.Fulltitle),
 			},
 		}, true
@@ -320,59 +295,3 @@ func printArray(s []string) {
 	str := strings.Join(s, ", ")
 	logger.Pl.I("FFprobe captured %s", str)
 }
-
-// get grabs key based on casing.
-func (tags ffprobeTags) get(key string) string {
-	// Direct match.
-	if k, exists := tags[key]; exists {
-		return k
-	}
-
-	// Try variants.
-	if k, exists := tags[strings.ToLower(key)]; exists {
-		return k
-	}
-	if k, exists := tags[strings.ToUpper(key)]; exists {
-		return k
-	}
-	if k, exists := tags[strings.ToTitle(key)]; exists {
-		return k
-	}
-
-	// Special WM/ case attempts:
-	// If key contains "WM/", try the part after it with case variants.
-	_, after, found := strings.Cut(key, "WM/")
-	if found && after != "" {
-		// Try direct match without recursion.
-		if k, exists := tags[after]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToLower(after)]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToUpper(after)]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToTitle(after)]; exists {
-			return k
-		}
-	}
-	// Also try adding "WM/" prefix if not already present.
-	if !found { // WM/ was not in the original key.
-		wmKey := "WM/" + key
-		if k, exists := tags[wmKey]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToLower(wmKey)]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToUpper(wmKey)]; exists {
-			return k
-		}
-		if k, exists := tags[strings.ToTitle(wmKey)]; exists {
-			return k
-		}
-	}
-
-	return ""
-}
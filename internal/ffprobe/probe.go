@@ -0,0 +1,57 @@
+package ffprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"metarr/internal/domain/logger"
+	"metarr/internal/models"
+	"os/exec"
+)
+
+// Probe returns the FFprobe data for a file's video, running FFprobe only on first use.
+//
+// Call Invalidate after the video file is replaced.
+func Probe(ctx context.Context, fd *models.FileData) (*models.ProbeData, error) {
+	if fd.Probe != nil {
+		return fd.Probe, nil
+	}
+	p, err := ProbeFile(ctx, fd.OriginalVideoPath)
+	if err != nil {
+		return nil, err
+	}
+	fd.Probe = p
+	return p, nil
+}
+
+// Invalidate drops a file's cached FFprobe data.
+func Invalidate(fd *models.FileData) {
+	fd.Probe = nil
+}
+
+// ProbeFile runs FFprobe on a path without caching.
+func ProbeFile(ctx context.Context, path string) (*models.ProbeData, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cannot probe empty path")
+	}
+	command := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+		path,
+	)
+
+	logger.Pl.D(2, "Made command for FFprobe:\n\n%v", command.String())
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed for %q: %w", path, err)
+	}
+
+	var p models.ProbeData
+	if err := json.Unmarshal(output, &p); err != nil {
+		return nil, fmt.Errorf("could not parse FFprobe output for %q: %w", path, err)
+	}
+	return &p, nil
+}
@@ -19,7 +19,7 @@ var (
 func BackupFile(file *os.File) error {
 	originalFilePath := file.Name()
 
-	backupFilePath := generateBackupFilename(originalFilePath)
+	backupFilePath := GenerateBackupFilename(originalFilePath)
 	logger.Pl.D(3, "Creating backup of file %q as %q", originalFilePath, backupFilePath)
 
 	// Current position.
@@ -63,8 +63,8 @@ func BackupFile(file *os.File) error {
 	return nil
 }
 
-// generateBackupFilename creates a backup filename by appending "_backup" to the original filename.
-func generateBackupFilename(originalFilePath string) string {
+// GenerateBackupFilename creates a backup filename by appending the backup tag to the original filename.
+func GenerateBackupFilename(originalFilePath string) string {
 	ext := filepath.Ext(originalFilePath)
 	base := parsing.GetFilepathWithoutExt(originalFilePath)
 
@@ -78,7 +78,7 @@ func RenameToBackup(filename string) (backupName string, err error) {
 	}
 
 	// Get backup name.
-	backupName = generateBackupFilename(filename)
+	backupName = GenerateBackupFilename(filename)
 
 	// Rename existing file to backup.
 	if err := os.Rename(filename, backupName); err != nil {
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// partialSuffixes mark files which are still being downloaded.
+var partialSuffixes = []string{".part", ".ytdl", ".temp", ".tmp", ".crdownload"}
+
+// formatIDRx matches yt-dlp's per-format suffix on partial downloads (e.g. 'Title.f137.mp4').
+var formatIDRx = regexp.MustCompile(`\.f\d+$`)
+
+var (
+	heldMu sync.RWMutex
+	held   = make(map[string]int) // Pending files per pair key.
+)
+
+// IsPartial returns true if the file is an unfinished download.
+func IsPartial(path string) bool {
+	lower := strings.ToLower(path)
+	for _, sfx := range partialSuffixes {
+		if strings.HasSuffix(lower, sfx) {
+			return true
+		}
+	}
+	return false
+}
+
+// PairKey returns the key shared by a video, its metafile and their partial downloads (e.g. 'Title.f137.mp4.part').
+//
+// The key is the normalized base name only, so a video holds back its metafile in a separate directory.
+func PairKey(path string) string {
+	name := filepath.Base(path)
+	for IsPartial(name) {
+		name = name[:len(name)-len(filepath.Ext(name))]
+	}
+
+	if trimmed := TrimMetafileSuffixes(name, ""); trimmed != name {
+		name = trimmed
+	} else {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	name = formatIDRx.ReplaceAllString(name, "")
+
+	return NormalizeFilename(name)
+}
+
+// Hold leaves a file's pair out of directory scans until Release, e.g. while the file is still being written.
+func Hold(path string) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	held[PairKey(path)]++
+}
+
+// Release undoes a Hold on a file.
+func Release(path string) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	key := PairKey(path)
+	if held[key] <= 1 {
+		delete(held, key)
+		return
+	}
+	held[key]--
+}
+
+// isHeld returns true if the file belongs to a held pair.
+func isHeld(path string) bool {
+	heldMu.RLock()
+	defer heldMu.RUnlock()
+	return held[PairKey(path)] > 0
+}
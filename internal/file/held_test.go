@@ -0,0 +1,119 @@
+package file
+
+import "testing"
+
+func TestIsPartial(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/dl/Title.mp4", false},
+		{"/dl/Title.mp4.part", true},
+		{"/dl/Title.f137.mp4.PART", true},
+		{"/dl/Title.mp4.ytdl", true},
+		{"/dl/Title.info.json.temp", true},
+		{"/dl/Title.mkv.crdownload", true},
+		{"/dl/Title.tmp", true},
+		{"/dl/Title.partial.mp4", false},
+	}
+	for _, tt := range tests {
+		if got := IsPartial(tt.path); got != tt.want {
+			t.Errorf("IsPartial(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPairKey(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/dl/Title.mp4", "title"},
+		{"/dl/Title.info.json", "title"},
+		{"/dl/Title.nfo", "title"},
+		{"/dl/Title.f137.mp4.part", "title"},
+		{"/dl/Title.f251.webm.part.ytdl", "title"},
+		{"/dl/Title.info.json.part", "title"},
+		{"/other/dir/Title.mkv", "title"},
+		{"/dl/My  Title.mp4", "mytitle"},
+		{"/dl/Title.metadata.json", "title"},
+		{"/dl/Title 2.mp4", "title2"},
+	}
+	for _, tt := range tests {
+		if got := PairKey(tt.path); got != tt.want {
+			t.Errorf("PairKey(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHold(t *testing.T) {
+	type step struct {
+		hold, release string
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		held     []string
+		released []string
+	}{
+		{
+			name:     "holds the whole pair",
+			steps:    []step{{hold: "/dl/Title.f137.mp4.part"}},
+			held:     []string{"/dl/Title.mp4", "/dl/Title.info.json", "/library/Title.nfo"},
+			released: []string{"/dl/Other.mp4"},
+		},
+		{
+			name:     "release undoes hold",
+			steps:    []step{{hold: "/dl/Title.mp4.part"}, {release: "/dl/Title.mp4.part"}},
+			released: []string{"/dl/Title.mp4", "/dl/Title.info.json"},
+		},
+		{
+			name: "stays held until every file is released",
+			steps: []step{
+				{hold: "/dl/Title.mp4.part"},
+				{hold: "/dl/Title.info.json"},
+				{release: "/dl/Title.mp4.part"},
+			},
+			held: []string{"/dl/Title.mp4"},
+		},
+		{
+			name: "extra release is ignored",
+			steps: []step{
+				{release: "/dl/Title.mp4"},
+				{hold: "/dl/Title.mp4"},
+			},
+			held: []string{"/dl/Title.info.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var holds []string
+			for _, s := range tt.steps {
+				if s.hold != "" {
+					Hold(s.hold)
+					holds = append(holds, s.hold)
+				}
+				if s.release != "" {
+					Release(s.release)
+				}
+			}
+			defer func() {
+				heldMu.Lock()
+				clear(held)
+				heldMu.Unlock()
+			}()
+
+			for _, p := range tt.held {
+				if !isHeld(p) {
+					t.Errorf("isHeld(%q) = false after %d hold(s), want true", p, len(holds))
+				}
+			}
+			for _, p := range tt.released {
+				if isHeld(p) {
+					t.Errorf("isHeld(%q) = true, want false", p)
+				}
+			}
+		})
+	}
+}
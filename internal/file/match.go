@@ -0,0 +1,349 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/domain/regex"
+	"metarr/internal/models"
+	"metarr/internal/parsing"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// Pairing strategies.
+const (
+	matchExact  = "exact"   // Normalized base names are equal.
+	matchTagID  = "tag-id"  // Both names contain the same bracketed ID (e.g. '[dQw4w9WgXcQ]').
+	matchJSONID = "json-id" // The video name contains the metafile's 'id' field.
+	matchFuzzy  = "fuzzy"   // Names are at least --match-threshold similar.
+)
+
+// minJSONIDLength avoids pairing on short IDs which could appear in any filename.
+const minJSONIDLength = 4
+
+// metaCandidate is a metafile which may be paired with a video.
+type metaCandidate struct {
+	key  string // Key in the metafile map.
+	fd   *models.FileData
+	base string // Base name without metafile suffixes.
+	name string // Normalized base name.
+
+	id       string // 'id' field of a JSON metafile, loaded on first use.
+	idLoaded bool
+}
+
+// indexMetafiles groups metafiles by subdirectory, sorted by key.
+func indexMetafiles(metaFiles map[string]*models.FileData) map[string][]*metaCandidate {
+	byDir := make(map[string][]*metaCandidate)
+	for key, fd := range metaFiles {
+		if fd == nil {
+			continue
+		}
+		base := TrimMetafileSuffixes(filepath.Base(key), "")
+		byDir[filepath.Dir(key)] = append(byDir[filepath.Dir(key)], &metaCandidate{
+			key:  key,
+			fd:   fd,
+			base: base,
+			name: NormalizeFilename(base),
+		})
+	}
+	for _, c := range byDir {
+		slices.SortFunc(c, func(a, b *metaCandidate) int { return strings.Compare(a.key, b.key) })
+	}
+	return byDir
+}
+
+// pairVideos pairs videos with metafiles in the same directory, trying each configured strategy in order.
+//
+// Returns the metafile key for each paired video, and the videos no strategy could pair unambiguously.
+func pairVideos(videoFiles map[string]*models.FileData, byDir map[string][]*metaCandidate) (pairs map[string]string, ambiguous []models.AmbiguousMatch) {
+	strategies := abstractions.GetStringSlice(keys.MatchStrategies)
+	if len(strategies) == 0 {
+		strategies = []string{matchExact}
+	}
+	threshold := abstractions.GetFloat64(keys.MatchThreshold)
+
+	videoKeys := make([]string, 0, len(videoFiles))
+	for k, fd := range videoFiles {
+		if fd != nil {
+			videoKeys = append(videoKeys, k)
+		}
+	}
+	slices.Sort(videoKeys)
+
+	pairs = make(map[string]string, len(videoKeys))
+	claimed := make(map[string]bool)
+	skip := make(map[string]bool)
+
+	for _, strategy := range strategies {
+		choice := make(map[string]*metaCandidate)
+		wantedBy := make(map[string][]string)
+
+		for _, v := range videoKeys {
+			if _, paired := pairs[v]; paired || skip[v] {
+				continue
+			}
+			videoBase := parsing.GetBaseNameWithoutExt(filepath.Base(v))
+			cands := candidatesFor(strategy, videoBase, byDir[filepath.Dir(v)], claimed, threshold)
+
+			switch len(cands) {
+			case 0:
+				continue
+			case 1:
+				choice[v] = cands[0]
+				wantedBy[cands[0].key] = append(wantedBy[cands[0].key], v)
+			default:
+				skip[v] = true
+				ambiguous = append(ambiguous, models.AmbiguousMatch{
+					Video:      videoFiles[v].OriginalVideoPath,
+					Strategy:   strategy,
+					Reason:     "several metafiles match",
+					Candidates: candidatePaths(cands),
+				})
+			}
+		}
+
+		for _, v := range videoKeys {
+			c, ok := choice[v]
+			if !ok {
+				continue
+			}
+			// Only exact pairing lets several videos share one metafile (e.g. 'Title.mp4' and 'Title.mkv').
+			if strategy != matchExact && len(wantedBy[c.key]) > 1 {
+				skip[v] = true
+				ambiguous = append(ambiguous, models.AmbiguousMatch{
+					Video:      videoFiles[v].OriginalVideoPath,
+					Strategy:   strategy,
+					Reason:     fmt.Sprintf("metafile also matches %d other video(s)", len(wantedBy[c.key])-1),
+					Candidates: []string{c.fd.MetaFilePath},
+				})
+				continue
+			}
+			pairs[v] = c.key
+			claimed[c.key] = true
+			if strategy != matchExact {
+				logger.Pl.I("Paired video %q with metafile %q (%s)", videoFiles[v].OriginalVideoPath, c.fd.MetaFilePath, strategy)
+			}
+		}
+	}
+	return pairs, ambiguous
+}
+
+// candidatesFor returns the metafiles a strategy would pair with a video.
+func candidatesFor(strategy, videoBase string, metas []*metaCandidate, claimed map[string]bool, threshold float64) []*metaCandidate {
+	var out []*metaCandidate
+
+	switch strategy {
+	case matchExact:
+		// First by sort order, as before strategies existed (e.g. 'Title.info.json' over 'Title.nfo').
+		name := NormalizeFilename(videoBase)
+		for _, c := range metas {
+			if c.name == name {
+				return []*metaCandidate{c}
+			}
+		}
+
+	case matchTagID:
+		ids := bracketedIDs(videoBase)
+		for _, c := range metas {
+			if claimed[c.key] {
+				continue
+			}
+			for _, id := range ids {
+				if strings.Contains(c.base, "["+id+"]") {
+					out = append(out, c)
+					break
+				}
+			}
+		}
+
+	case matchJSONID:
+		for _, c := range metas {
+			if claimed[c.key] {
+				continue
+			}
+			if id := c.jsonID(); len(id) >= minJSONIDLength && containsToken(videoBase, id) {
+				out = append(out, c)
+			}
+		}
+
+	case matchFuzzy:
+		name := NormalizeFilename(videoBase)
+		best := 0.0
+		for _, c := range metas {
+			if claimed[c.key] {
+				continue
+			}
+			score := similarity(name, c.name)
+			switch {
+			case score < threshold || score < best:
+				continue
+			case score > best:
+				best = score
+				out = out[:0]
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// jsonID returns the 'id' field of a JSON metafile, or "" for other metafiles.
+func (c *metaCandidate) jsonID() string {
+	if c.idLoaded {
+		return c.id
+	}
+	c.idLoaded = true
+
+	if c.fd.MetaFileType != sharedconsts.MExtJSON {
+		return ""
+	}
+	data, err := os.ReadFile(c.fd.MetaFilePath)
+	if err != nil {
+		logger.Pl.W("Could not read %q for its ID: %v", c.fd.MetaFilePath, err)
+		return ""
+	}
+	var meta struct {
+		ID any `json:"id"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		logger.Pl.W("Could not decode %q for its ID: %v", c.fd.MetaFilePath, err)
+		return ""
+	}
+	switch id := meta.ID.(type) {
+	case string:
+		c.id = strings.TrimSpace(id)
+	case float64:
+		c.id = fmt.Sprintf("%.0f", id)
+	}
+	return c.id
+}
+
+// bracketedIDs returns the IDs in square brackets in a filename, ignoring date tags.
+func bracketedIDs(name string) []string {
+	var ids []string
+	for _, m := range regex.BracketedIDCompile().FindAllStringSubmatch(name, -1) {
+		if !regex.DateTagCompile().MatchString(m[1]) {
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
+}
+
+// containsToken checks whether s contains tok, not directly surrounded by other ID characters.
+func containsToken(s, tok string) bool {
+	for i := 0; ; {
+		idx := strings.Index(s[i:], tok)
+		if idx == -1 {
+			return false
+		}
+		start, end := i+idx, i+idx+len(tok)
+		if (start == 0 || !isIDChar(s[start-1])) && (end == len(s) || !isIDChar(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+// isIDChar reports whether b can be part of a video ID.
+func isIDChar(b byte) bool {
+	return b == '-' || b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// similarity returns how alike two strings are, from 0 to 1 (1 - edit distance / longer length).
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// unpairedReport lists unmatched videos and orphan metafiles, each with the closest name on the other side.
+//
+// Metafiles which were candidates in an ambiguous pairing are not orphans.
+func unpairedReport(unmatched, videoFiles map[string]*models.FileData, byDir map[string][]*metaCandidate, pairs map[string]string, ambiguous []models.AmbiguousMatch) (videos, orphans []models.UnpairedFile) {
+	for videoKey, fd := range unmatched {
+		u := models.UnpairedFile{Path: fd.OriginalVideoPath}
+		name := NormalizeFilename(parsing.GetBaseNameWithoutExt(videoKey))
+		for _, c := range byDir[filepath.Dir(videoKey)] {
+			if score := similarity(name, c.name); score > u.Similarity {
+				u.Closest, u.Similarity = c.fd.MetaFilePath, roundScore(score)
+			}
+		}
+		videos = append(videos, u)
+	}
+
+	used := make(map[string]bool, len(pairs))
+	for _, metaKey := range pairs {
+		used[metaKey] = true
+	}
+	inAmbiguous := make(map[string]bool)
+	for _, a := range ambiguous {
+		for _, c := range a.Candidates {
+			inAmbiguous[c] = true
+		}
+	}
+
+	for dir, metas := range byDir {
+		for _, c := range metas {
+			if used[c.key] || inAmbiguous[c.fd.MetaFilePath] {
+				continue
+			}
+			o := models.UnpairedFile{Path: c.fd.MetaFilePath}
+			for videoKey, fd := range videoFiles {
+				if fd == nil || filepath.Dir(videoKey) != dir {
+					continue
+				}
+				if score := similarity(c.name, NormalizeFilename(parsing.GetBaseNameWithoutExt(videoKey))); score > o.Similarity {
+					o.Closest, o.Similarity = fd.OriginalVideoPath, roundScore(score)
+				}
+			}
+			orphans = append(orphans, o)
+		}
+	}
+
+	slices.SortFunc(videos, func(a, b models.UnpairedFile) int { return strings.Compare(a.Path, b.Path) })
+	slices.SortFunc(orphans, func(a, b models.UnpairedFile) int { return strings.Compare(a.Path, b.Path) })
+	return videos, orphans
+}
+
+// roundScore rounds a similarity score to two decimal places for reporting.
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+// candidatePaths returns the metafile paths of candidates.
+func candidatePaths(cands []*metaCandidate) []string {
+	paths := make([]string, 0, len(cands))
+	for _, c := range cands {
+		paths = append(paths, c.fd.MetaFilePath)
+	}
+	return paths
+}
@@ -0,0 +1,229 @@
+package file
+
+import (
+	"maps"
+	"math"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"title", "title", 1},
+		{"title", "", 0},
+		{"abcd", "abce", 0.75},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"ünï", "uni", 1 - 2.0/3},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestContainsToken(t *testing.T) {
+	tests := []struct {
+		s, tok string
+		want   bool
+	}{
+		{"Clip dQw4w9WgXcQ", "dQw4w9WgXcQ", true},
+		{"dQw4w9WgXcQ", "dQw4w9WgXcQ", true},
+		{"Clip (dQw4w9WgXcQ) 1080p", "dQw4w9WgXcQ", true},
+		{"Clip xdQw4w9WgXcQ", "dQw4w9WgXcQ", false},
+		{"Clip dQw4w9WgXcQ-2", "dQw4w9WgXcQ", false},
+		{"1234 and 12345", "1234", true},
+		{"12345", "1234", false},
+		{"Clip", "dQw4w9WgXcQ", false},
+	}
+	for _, tt := range tests {
+		if got := containsToken(tt.s, tt.tok); got != tt.want {
+			t.Errorf("containsToken(%q, %q) = %v, want %v", tt.s, tt.tok, got, tt.want)
+		}
+	}
+}
+
+func TestBracketedIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Title [dQw4w9WgXcQ]", []string{"dQw4w9WgXcQ"}},
+		{"Title [2024-01-02] [abc_123-x]", []string{"abc_123-x"}},
+		{"Title [short]", nil},
+		{"Title [a1b2c3] [d4e5f6]", []string{"a1b2c3", "d4e5f6"}},
+		{"Title", nil},
+	}
+	for _, tt := range tests {
+		if got := bracketedIDs(tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("bracketedIDs(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPairVideos(t *testing.T) {
+	dir := t.TempDir()
+	idMeta := filepath.Join(dir, "Uploaded clip.info.json")
+	if err := os.WriteFile(idMeta, []byte(`{"id": "dQw4w9WgXcQ"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		strategies    []string
+		videos        []string
+		metas         []string
+		want          map[string]string // Video to metafile.
+		wantAmbiguous []string          // Videos.
+	}{
+		{
+			name:   "exact",
+			videos: []string{"/lib/Title.mp4", "/lib/Other.mp4"},
+			metas:  []string{"/lib/Title.info.json"},
+			want:   map[string]string{"/lib/Title.mp4": "/lib/Title.info.json"},
+		},
+		{
+			name:   "exact ignores case and spacing",
+			videos: []string{"/lib/My  Title.mp4"},
+			metas:  []string{"/lib/my title.info.json"},
+			want:   map[string]string{"/lib/My  Title.mp4": "/lib/my title.info.json"},
+		},
+		{
+			name:   "exact shares a metafile",
+			videos: []string{"/lib/Title.mp4", "/lib/Title.mkv"},
+			metas:  []string{"/lib/Title.info.json"},
+			want: map[string]string{
+				"/lib/Title.mp4": "/lib/Title.info.json",
+				"/lib/Title.mkv": "/lib/Title.info.json",
+			},
+		},
+		{
+			name:   "exact prefers the first metafile by name",
+			videos: []string{"/lib/Title.mp4"},
+			metas:  []string{"/lib/Title.nfo", "/lib/Title.info.json"},
+			want:   map[string]string{"/lib/Title.mp4": "/lib/Title.info.json"},
+		},
+		{
+			name:   "exact stays in the same directory",
+			videos: []string{"/lib/a/Title.mp4"},
+			metas:  []string{"/lib/b/Title.info.json"},
+			want:   map[string]string{},
+		},
+		{
+			name:       "tag ID after exact",
+			strategies: []string{matchExact, matchTagID},
+			videos:     []string{"/lib/Title.mp4", "/lib/Renamed [dQw4w9WgXcQ].mp4"},
+			metas:      []string{"/lib/Title.info.json", "/lib/Original [dQw4w9WgXcQ].info.json"},
+			want: map[string]string{
+				"/lib/Title.mp4":                 "/lib/Title.info.json",
+				"/lib/Renamed [dQw4w9WgXcQ].mp4": "/lib/Original [dQw4w9WgXcQ].info.json",
+			},
+		},
+		{
+			name:          "tag ID with several metafiles",
+			strategies:    []string{matchTagID},
+			videos:        []string{"/lib/Clip [dQw4w9WgXcQ].mp4"},
+			metas:         []string{"/lib/A [dQw4w9WgXcQ].info.json", "/lib/B [dQw4w9WgXcQ].nfo"},
+			want:          map[string]string{},
+			wantAmbiguous: []string{"/lib/Clip [dQw4w9WgXcQ].mp4"},
+		},
+		{
+			name:          "tag ID metafile wanted by several videos",
+			strategies:    []string{matchTagID},
+			videos:        []string{"/lib/A [dQw4w9WgXcQ].mp4", "/lib/B [dQw4w9WgXcQ].mp4"},
+			metas:         []string{"/lib/Clip [dQw4w9WgXcQ].info.json"},
+			want:          map[string]string{},
+			wantAmbiguous: []string{"/lib/A [dQw4w9WgXcQ].mp4", "/lib/B [dQw4w9WgXcQ].mp4"},
+		},
+		{
+			name:       "JSON ID",
+			strategies: []string{matchJSONID},
+			videos:     []string{filepath.Join(dir, "Clip dQw4w9WgXcQ.mp4")},
+			metas:      []string{idMeta},
+			want:       map[string]string{filepath.Join(dir, "Clip dQw4w9WgXcQ.mp4"): idMeta},
+		},
+		{
+			name:       "JSON ID inside another ID",
+			strategies: []string{matchJSONID},
+			videos:     []string{filepath.Join(dir, "Clip xdQw4w9WgXcQ.mp4")},
+			metas:      []string{idMeta},
+			want:       map[string]string{},
+		},
+		{
+			name:       "fuzzy",
+			strategies: []string{matchFuzzy},
+			videos:     []string{"/lib/My Great Video.mp4"},
+			metas:      []string{"/lib/My Great Vide0.info.json", "/lib/Something else.info.json"},
+			want:       map[string]string{"/lib/My Great Video.mp4": "/lib/My Great Vide0.info.json"},
+		},
+		{
+			name:       "fuzzy below threshold",
+			strategies: []string{matchFuzzy},
+			videos:     []string{"/lib/My Great Video.mp4"},
+			metas:      []string{"/lib/Another Clip.info.json"},
+			want:       map[string]string{},
+		},
+		{
+			name:          "fuzzy tie",
+			strategies:    []string{matchFuzzy},
+			videos:        []string{"/lib/Episode 10.mp4"},
+			metas:         []string{"/lib/Episode 11.info.json", "/lib/Episode 12.info.json"},
+			want:          map[string]string{},
+			wantAmbiguous: []string{"/lib/Episode 10.mp4"},
+		},
+		{
+			name:       "fuzzy skips claimed metafiles",
+			strategies: []string{matchExact, matchFuzzy},
+			videos:     []string{"/lib/Episode 11.mp4", "/lib/Episode 1l.mp4"},
+			metas:      []string{"/lib/Episode 11.info.json", "/lib/Episode 12.info.json"},
+			want: map[string]string{
+				"/lib/Episode 11.mp4": "/lib/Episode 11.info.json",
+				"/lib/Episode 1l.mp4": "/lib/Episode 12.info.json",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.Set(keys.MatchStrategies, tt.strategies)
+			v.Set(keys.MatchThreshold, 0.8)
+			abstractions.Use(v)
+			defer abstractions.Use(nil)
+
+			videoFiles := make(map[string]*models.FileData, len(tt.videos))
+			for _, p := range tt.videos {
+				videoFiles[p] = &models.FileData{OriginalVideoPath: p}
+			}
+			metaFiles := make(map[string]*models.FileData, len(tt.metas))
+			for _, p := range tt.metas {
+				metaFiles[p] = &models.FileData{MetaFilePath: p, MetaFileType: filepath.Ext(p)}
+			}
+
+			pairs, ambiguous := pairVideos(videoFiles, indexMetafiles(metaFiles))
+			if !maps.Equal(pairs, tt.want) {
+				t.Errorf("pairs = %v, want %v", pairs, tt.want)
+			}
+
+			var gotAmbiguous []string
+			for _, a := range ambiguous {
+				gotAmbiguous = append(gotAmbiguous, a.Video)
+			}
+			slices.Sort(gotAmbiguous)
+			if !slices.Equal(gotAmbiguous, tt.wantAmbiguous) {
+				t.Errorf("ambiguous = %q, want %q", gotAmbiguous, tt.wantAmbiguous)
+			}
+		})
+	}
+}
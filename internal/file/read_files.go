@@ -2,11 +2,13 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"metarr/internal/abstractions"
 	"metarr/internal/domain/consts"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
+	"metarr/internal/events"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
 	"os"
@@ -35,83 +37,75 @@ func InitFetchFilesVars() (err error) {
 
 	// Set video map.
 	for k := range sharedconsts.FilterByVidExtensions {
-		// Set all true.
-		if allV {
-			sharedconsts.FilterByVidExtensions[k] = true
-			continue
-		}
-		// Selective set.
-		for _, ve := range inVExts {
-			if k == ve {
-				sharedconsts.FilterByVidExtensions[k] = true
-			}
-		}
+		// All, or selective set (re-initialized for each job in server mode).
+		sharedconsts.FilterByVidExtensions[k] = allV || slices.Contains(inVExts, k)
 	}
 
 	// Set meta map.
 	for k := range sharedconsts.FilterByMetaExtension {
-		// Set all true.
-		if allM {
-			sharedconsts.FilterByMetaExtension[k] = true
-			continue
-		}
-		// Selective set.
-		for _, me := range inMExts {
-			if k == me {
-				sharedconsts.FilterByMetaExtension[k] = true
-			}
-		}
+		// All, or selective set.
+		sharedconsts.FilterByMetaExtension[k] = allM || slices.Contains(inMExts, k)
 	}
 	return nil
 }
 
-// GetVideoFiles fetches video files from a directory.
+// GetVideoFiles fetches video files from a directory and its subdirectories.
+//
+// Map keys are paths relative to the input directory.
 func GetVideoFiles(videoDir *os.File) (map[string]*models.FileData, error) {
-	files, err := videoDir.ReadDir(-1)
+	files, err := newDirWalker(videoDir.Name()).walk()
 	if err != nil {
 		return nil, fmt.Errorf("error reading video directory %q: %w", videoDir.Name(), err)
 	}
 	logger.Pl.I("Filtering video directory %q:\nFile extensions: %v\n\n", videoDir.Name(), sharedconsts.FilterByVidExtensions)
 
-	// Iterate over video files in directory.
+	// Iterate over video files in directory tree.
 	videoFiles := make(map[string]*models.FileData, len(files))
 	for _, file := range files {
+		// FFmpeg temp output, either in use or left over (handled at startup by RecoverTempFiles).
+		if strings.HasPrefix(file.name, consts.TempTag) {
+			logger.Pl.D(1, "Skipping FFmpeg temp file %q", file.path)
+			continue
+		}
+
 		// Text filters
 		if abstractions.IsSet(keys.FilePrefixes) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FilePrefixes), strings.HasPrefix) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FilePrefixes), strings.HasPrefix) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileSuffixes) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileSuffixes), strings.HasSuffix) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileSuffixes), strings.HasSuffix) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileContains) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileContains), strings.Contains) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileContains), strings.Contains) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileOmits) {
-			if matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileOmits), strings.Contains) {
+			if matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileOmits), strings.Contains) {
 				continue
 			}
 		}
 
-		// Other checks (is not a directory, has a video extension, is not a Metarr backup).
-		if !file.IsDir() && hasFileExtension(file.Name(), sharedconsts.FilterByVidExtensions) {
-			videoFilenameBase := filepath.Base(file.Name())
-
+		// Other checks (has a video extension, is not a Metarr backup or mid-swap original).
+		if hasFileExtension(file.name, sharedconsts.FilterByVidExtensions) {
 			m := models.NewFileData()
 
-			m.OriginalVideoPath = filepath.Join(videoDir.Name(), file.Name())
-			m.VideoDirectory = videoDir.Name()
+			m.OriginalVideoPath = file.path
+			m.VideoDirectory = filepath.Dir(file.path)
 
-			if !strings.Contains(parsing.GetBaseNameWithoutExt(m.OriginalVideoPath), consts.BackupTag) {
-				videoFiles[file.Name()] = m
-				logger.Pl.I("Added video to queue: %v", videoFilenameBase)
-			} else {
+			baseName := parsing.GetBaseNameWithoutExt(m.OriginalVideoPath)
+			switch {
+			case strings.Contains(baseName, consts.BackupTag):
 				logger.Pl.I("Skipping file %q containing backup tag (%q)", m.OriginalVideoPath, consts.BackupTag)
+			case strings.Contains(baseName, consts.SwapTag):
+				logger.Pl.W("Skipping file %q containing swap tag (%q), an interrupted swap may need manual review", m.OriginalVideoPath, consts.SwapTag)
+			default:
+				videoFiles[file.rel] = m
+				logger.Pl.I("Added video to queue: %v", file.rel)
 			}
 		}
 	}
@@ -121,72 +115,71 @@ func GetVideoFiles(videoDir *os.File) (map[string]*models.FileData, error) {
 	return videoFiles, nil
 }
 
-// GetMetadataFiles fetches metadata files from a directory.
+// GetMetadataFiles fetches metadata files from a directory and its subdirectories.
+//
+// Map keys are paths relative to the input directory.
 func GetMetadataFiles(metaDir *os.File) (map[string]*models.FileData, error) {
-	files, err := metaDir.ReadDir(-1)
+	files, err := newDirWalker(metaDir.Name()).walk()
 	if err != nil {
 		return nil, fmt.Errorf("error reading metadata directory %q: %w", metaDir.Name(), err)
 	}
-	logger.Pl.I("Filtering video directory %q:\nFile extensions: %v\n\n", metaDir.Name(), sharedconsts.FilterByMetaExtension)
+	logger.Pl.I("Filtering metadata directory %q:\nFile extensions: %v\n\n", metaDir.Name(), sharedconsts.FilterByMetaExtension)
 
-	// Iterate over metadata files in directory.
+	// Iterate over metadata files in directory tree.
 	metaFiles := make(map[string]*models.FileData, len(files))
 	for _, file := range files {
-		ext := filepath.Ext(file.Name())
-		logger.Pl.D(3, "Checking file %q with extension %q", file.Name(), ext)
+		ext := filepath.Ext(file.name)
+		logger.Pl.D(3, "Checking file %q with extension %q", file.path, ext)
 
 		// Text filters.
 		if abstractions.IsSet(keys.FilePrefixes) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FilePrefixes), strings.HasPrefix) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FilePrefixes), strings.HasPrefix) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileSuffixes) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileSuffixes), strings.HasSuffix) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileSuffixes), strings.HasSuffix) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileContains) {
-			if !matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileContains), strings.Contains) {
+			if !matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileContains), strings.Contains) {
 				continue
 			}
 		}
 		if abstractions.IsSet(keys.FileOmits) {
-			if matchesFilenameFilter(file.Name(), abstractions.GetStringSlice(keys.FileOmits), strings.Contains) {
+			if matchesFilenameFilter(file.name, abstractions.GetStringSlice(keys.FileOmits), strings.Contains) {
 				continue
 			}
 		}
 
-		// File is a directory or does not have meta extensions.
-		if file.IsDir() || !sharedconsts.FilterByMetaExtension[ext] {
+		// File does not have meta extensions.
+		if !sharedconsts.FilterByMetaExtension[ext] {
 			continue
 		}
 
 		// Check extensions.
 		m := models.NewFileData()
-		metaFilenameBase := filepath.Base(file.Name())
-		metaBaseName := parsing.GetBaseNameWithoutExt(metaFilenameBase)
-
-		filePath := filepath.Join(metaDir.Name(), file.Name())
+		metaBaseName := parsing.GetBaseNameWithoutExt(file.name)
 
 		// Check if valid metafile is present.
 		for k := range sharedconsts.FilterByMetaExtension {
 			if ext == k {
-				logger.Pl.D(1, "Detected %s file %q", strings.ToUpper(ext), file.Name())
-				m.MetaFilePath = filePath
-				m.MetaDirectory = metaDir.Name()
+				logger.Pl.D(1, "Detected %s file %q", strings.ToUpper(ext), file.path)
+				m.MetaFilePath = file.path
+				m.MetaDirectory = filepath.Dir(file.path)
 				m.MetaFileType = ext
 			}
 		}
 
 		// Skip if it's a Metarr-generated backup file.
 		if !strings.Contains(metaBaseName, consts.BackupTag) {
-			metaFiles[file.Name()] = m
+			metaFiles[file.rel] = m
 		} else {
 			logger.Pl.I("Skipping file %q containing backup tag (%q)", metaBaseName, consts.BackupTag)
 		}
 	}
-	if len(metaFiles) == 0 {
+	if len(metaFiles) == 0 && !abstractions.GetBool(keys.StubMetadata) {
 		return nil, fmt.Errorf("no meta files with extensions: %v or matching file filters found in directory: %s", sharedconsts.FilterByMetaExtension, metaDir.Name())
 	}
 	logger.Pl.D(3, "Returning meta files %v", metaFiles)
@@ -232,36 +225,66 @@ func GetSingleMetadataFile(metaFile *os.File) (map[string]*models.FileData, erro
 }
 
 // MatchVideoWithMetadata matches video files with their corresponding metadata files.
-func MatchVideoWithMetadata(videoFiles, metaFiles map[string]*models.FileData, batchID int64) (map[string]*models.FileData, error) {
+//
+// Unmatched videos get a stub metafile if enabled, otherwise they are skipped and listed in the returned report.
+func MatchVideoWithMetadata(ctx context.Context, videoFiles, metaFiles map[string]*models.FileData, batchID int64) (map[string]*models.FileData, *models.MatchReport, error) {
 	logger.Pl.D(3, "Entering metadata and video file matching loop...")
 
-	// Pre-process metaFiles into a lookup map.
-	metaLookup := make(map[string]*models.FileData, len(metaFiles))
-	for metaFilename, metaFileData := range metaFiles {
-		baseKey := NormalizeFilename(TrimMetafileSuffixes(metaFilename, ""))
-		metaLookup[baseKey] = metaFileData
+	byDir := indexMetafiles(metaFiles)
+	pairs, ambiguous := pairVideos(videoFiles, byDir)
+	report := &models.MatchReport{BatchID: batchID, Ambiguous: ambiguous}
+	isAmbiguous := make(map[string]bool, len(ambiguous))
+	for _, a := range ambiguous {
+		isAmbiguous[a.Video] = true
 	}
 
 	// Find metadata file matches for video files.
+	stubMissing := abstractions.GetBool(keys.StubMetadata)
 	matchedFiles := make(map[string]*models.FileData, len(videoFiles))
+	unmatched := make(map[string]*models.FileData)
 	for videoFilename := range videoFiles {
 		videoData := videoFiles[videoFilename]
 		if videoData == nil {
 			logger.Pl.W("Skipping nil video file entry: %s", videoFilename)
 			continue
 		}
-		videoBase := parsing.GetBaseNameWithoutExt(videoFilename)
-		normalizedVideoBase := NormalizeFilename(videoBase)
 
-		if fileData, exists := metaLookup[normalizedVideoBase]; exists && fileData != nil { // This checks if the key exists in the metaLookup map.
+		if metaKey, exists := pairs[videoFilename]; exists {
+			fileData := metaFiles[metaKey]
 			matchedFiles[videoFilename] = videoData
 			matchedFiles[videoFilename].MetaFilePath = fileData.MetaFilePath
 			matchedFiles[videoFilename].MetaDirectory = fileData.MetaDirectory
 			matchedFiles[videoFilename].MetaFileType = fileData.MetaFileType
+		} else if isAmbiguous[videoData.OriginalVideoPath] {
+			continue
+		} else if stubMissing {
+			if err := CreateStubMetafile(ctx, videoData); err != nil {
+				logger.Pl.E("Could not create stub metadata for %q: %v", videoData.OriginalVideoPath, err)
+				unmatched[videoFilename] = videoData
+				continue
+			}
+			matchedFiles[videoFilename] = videoData
+		} else {
+			unmatched[videoFilename] = videoData
+			continue
+		}
+
+		events.Publish(events.Event{
+			Type:  events.FileMatched,
+			Video: videoData.OriginalVideoPath,
+			Meta:  videoData.MetaFilePath,
+		})
+
+		// Thumbnail and subtitle sidecars with the same base name.
+		videoData.ThumbnailSidecar = FindThumbnailSidecar(videoData.OriginalVideoPath)
+		if abstractions.GetBool(keys.MuxSubtitles) {
+			videoData.Subtitles = FindSubtitleSidecars(videoData.OriginalVideoPath)
 		}
 	}
+	report.Unmatched, report.Orphans = unpairedReport(unmatched, videoFiles, byDir, pairs, ambiguous)
+
 	if len(matchedFiles) == 0 {
-		return nil, fmt.Errorf("no matching metadata files found for any videos (batch ID: %d)", batchID)
+		return nil, report, fmt.Errorf("no matching metadata files found for any videos (batch ID: %d)", batchID)
 	}
-	return matchedFiles, nil
+	return matchedFiles, report, nil
 }
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/ffprobe"
+	"metarr/internal/journal"
+	"metarr/internal/models"
+	"metarr/internal/parsing"
+	"metarr/internal/plan"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+	"github.com/TubarrApp/gocommon/sharedtags"
+)
+
+// filenameDateRx matches dates in camera and screen recorder filenames ('VID_20230514_123456', 'Screen Recording 2023-05-14 at ...').
+var filenameDateRx = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})[-_.]?(\d{2})[-_.]?(\d{2})(?:\D|$)`)
+
+// stubTags are the container tags copied into a stub metafile.
+var stubTags = []string{
+	sharedtags.JTitle,
+	sharedtags.JDescription,
+	sharedtags.JComment,
+	sharedtags.JArtist,
+	sharedtags.JComposer,
+	"genre",
+}
+
+// CreateStubMetafile writes a JSON metafile beside a video which has none, built from its container tags, filename and timestamps.
+//
+// In dry-run mode the stub is written to a temporary directory instead.
+func CreateStubMetafile(ctx context.Context, fd *models.FileData) error {
+	videoPath := fd.OriginalVideoPath
+	metaPath := parsing.GetFilepathWithoutExt(videoPath) + sharedconsts.MExtJSON
+	if exists(metaPath) {
+		return fmt.Errorf("not overwriting existing file %q with stub metadata", metaPath)
+	}
+
+	probe, err := ffprobe.Probe(ctx, fd)
+	if err != nil {
+		return fmt.Errorf("could not read tags for stub metadata: %w", err)
+	}
+
+	meta := make(map[string]any, len(stubTags)+1)
+	for _, tag := range stubTags {
+		if v := probe.Format.Tags.Get(tag); v != "" {
+			meta[tag] = v
+		}
+	}
+	if _, ok := meta[sharedtags.JTitle]; !ok {
+		meta[sharedtags.JTitle] = parsing.GetBaseNameWithoutExt(videoPath)
+	}
+	if date := stubDate(videoPath, probe.Format.Tags.Get(sharedtags.JCreationTime)); date != "" {
+		meta[sharedtags.JUploadDate] = date
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stub metadata for %q: %w", videoPath, err)
+	}
+
+	// Write to a scratch directory in dry-run mode.
+	writePath := metaPath
+	if plan.Enabled() {
+		dir, err := plan.ScratchDir()
+		if err != nil {
+			return err
+		}
+		writePath = filepath.Join(dir, filepath.Base(metaPath))
+	}
+
+	f, err := os.OpenFile(writePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, consts.PermsJSONFile)
+	if err != nil {
+		return fmt.Errorf("failed to create stub metafile %q: %w", writePath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write stub metafile %q: %w", writePath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close stub metafile %q: %w", writePath, err)
+	}
+
+	fd.MetaFilePath = metaPath
+	fd.MetaFileType = sharedconsts.MExtJSON
+	if plan.Enabled() {
+		plan.AddOperation(fd, plan.OpCreate, metaPath, "") // Plan lists the real path.
+	} else {
+		journal.Record(journal.OpCreate, metaPath, "")
+		logger.Pl.S("Created stub metafile %q", metaPath)
+	}
+	fd.MetaFilePath = writePath
+	fd.MetaDirectory = filepath.Dir(writePath)
+	return nil
+}
+
+// stubDate returns a YYYYMMDD date from the creation time tag, the filename, or the file's modification time (in that order).
+func stubDate(videoPath, creationTime string) string {
+	if creationTime != "" {
+		if t, err := time.Parse(time.RFC3339Nano, creationTime); err == nil && !t.IsZero() && t.Year() > 1970 {
+			return t.Format("20060102")
+		}
+	}
+
+	if m := filenameDateRx.FindStringSubmatch(filepath.Base(videoPath)); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if month >= 1 && month <= 12 && t.Day() == day {
+			return m[1] + m[2] + m[3]
+		}
+	}
+
+	if info, err := os.Stat(videoPath); err == nil {
+		return info.ModTime().Format("20060102")
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"fmt"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/journal"
+	"metarr/internal/models"
+	"metarr/internal/parsing"
+	"metarr/internal/plan"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// subtitleSidecarCodecs maps subtitle file extensions to FFmpeg codec names.
+var subtitleSidecarCodecs = map[string]string{
+	".srt": "subrip",
+	".vtt": "webvtt",
+	".ass": "ass",
+	".ssa": "ass",
+}
+
+// iso6391To6392 maps common two-letter language codes (as used by yt-dlp) to the three-letter codes containers expect.
+var iso6391To6392 = map[string]string{
+	"ar": "ara", "bg": "bul", "bn": "ben", "ca": "cat", "cs": "ces", "da": "dan",
+	"de": "deu", "el": "ell", "en": "eng", "es": "spa", "et": "est", "fa": "fas",
+	"fi": "fin", "fr": "fra", "he": "heb", "hi": "hin", "hr": "hrv", "hu": "hun",
+	"id": "ind", "is": "isl", "it": "ita", "ja": "jpn", "ko": "kor", "lt": "lit",
+	"lv": "lav", "ms": "msa", "nl": "nld", "no": "nor", "nb": "nob", "pl": "pol",
+	"pt": "por", "ro": "ron", "ru": "rus", "sk": "slk", "sl": "slv", "sr": "srp",
+	"sv": "swe", "ta": "tam", "th": "tha", "tl": "tgl", "tr": "tur", "uk": "ukr",
+	"ur": "urd", "vi": "vie", "zh": "zho",
+}
+
+// FindSubtitleSidecars returns subtitle files beside a video sharing its base name (e.g. 'Title.en.vtt').
+//
+// Only one file is kept per language, preferring an exact language tag ('en') over variants ('en-orig').
+func FindSubtitleSidecars(videoPath string) []models.SubtitleSidecar {
+	dir := filepath.Dir(videoPath)
+	videoBase := parsing.GetBaseNameWithoutExt(videoPath)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Pl.E("Could not read directory %q for subtitle files: %v", dir, err)
+		return nil
+	}
+
+	var (
+		sidecars []models.SubtitleSidecar
+		byLang   = make(map[string]int)  // Index of the kept file for each language.
+		exact    = make(map[string]bool) // Whether the kept file has an exact language tag.
+	)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		codec, isSub := subtitleSidecarCodecs[ext]
+		if !isSub {
+			continue
+		}
+
+		// 'Title.srt' or 'Title.<tag>.srt'.
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		var tag string
+		switch {
+		case stem == videoBase:
+		case strings.HasPrefix(stem, videoBase+"."):
+			tag = strings.TrimPrefix(stem, videoBase+".")
+		default:
+			continue
+		}
+
+		s := models.SubtitleSidecar{
+			Path:     filepath.Join(dir, name),
+			Language: parseSubtitleLanguage(tag),
+			Codec:    codec,
+		}
+		logger.Pl.I("Found subtitle file %q (language %q) for video %q", s.Path, s.Language, videoPath)
+
+		// Untagged or unknown languages can't be compared, keep them all.
+		if s.Language == "und" {
+			sidecars = append(sidecars, s)
+			continue
+		}
+		isExact := isExactLanguageTag(tag)
+		i, seen := byLang[s.Language]
+		switch {
+		case !seen:
+			byLang[s.Language] = len(sidecars)
+			exact[s.Language] = isExact
+			sidecars = append(sidecars, s)
+		case isExact && !exact[s.Language]:
+			logger.Pl.I("Using subtitle file %q over %q for language %q", s.Path, sidecars[i].Path, s.Language)
+			sidecars[i] = s
+			exact[s.Language] = true
+		default:
+			logger.Pl.I("Skipping subtitle file %q, already have %q for language %q", s.Path, sidecars[i].Path, s.Language)
+		}
+	}
+	return sidecars
+}
+
+// isExactLanguageTag returns true if a subtitle tag is only a language code ('en', 'eng'), not a variant ('en-orig', 'en.forced').
+func isExactLanguageTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, ".-_")
+}
+
+// parseSubtitleLanguage gets an ISO 639-2 code from a yt-dlp subtitle tag (e.g. "en-orig" → "eng").
+func parseSubtitleLanguage(tag string) string {
+	tag, _, _ = strings.Cut(strings.ToLower(tag), ".")
+	lang, _, _ := strings.Cut(tag, "-")
+	lang, _, _ = strings.Cut(lang, "_")
+
+	for _, r := range lang {
+		if r < 'a' || r > 'z' {
+			return "und"
+		}
+	}
+	switch len(lang) {
+	case 2:
+		if code, ok := iso6391To6392[lang]; ok {
+			return code
+		}
+	case 3:
+		return lang
+	}
+	return "und"
+}
+
+// HandleSubtitleSidecars deletes or moves muxed subtitle files according to the user's setting.
+func HandleSubtitleSidecars(fd *models.FileData, paths []string) error {
+	action, targetDir, _ := strings.Cut(abstractions.GetString(keys.SubtitleSidecars), ":")
+	if len(paths) == 0 || (action != "delete" && action != "move") {
+		return nil
+	}
+
+	// Create the target directory for moves.
+	if action == "move" {
+		if !filepath.IsAbs(targetDir) {
+			targetDir = filepath.Join(fd.VideoDirectory, targetDir)
+		}
+		if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+			if plan.Enabled() {
+				plan.AddOperation(fd, plan.OpMkdir, targetDir, "")
+			} else {
+				if err := os.MkdirAll(targetDir, 0o755); err != nil {
+					return fmt.Errorf("failed to create subtitle directory %q: %w", targetDir, err)
+				}
+				journal.Record(journal.OpMkdir, targetDir, "")
+			}
+		}
+	}
+
+	for _, src := range paths {
+		switch action {
+		case "delete":
+			if err := deleteSidecar(fd, src); err != nil {
+				return err
+			}
+
+		case "move":
+			dst := filepath.Join(targetDir, filepath.Base(src))
+			if plan.Enabled() {
+				plan.AddOperation(fd, plan.OpMove, src, dst)
+				continue
+			}
+			if err := moveOrCopyFile(src, dst); err != nil {
+				return fmt.Errorf("failed to move subtitle file %q → %q: %w", src, dst, err)
+			}
+			journal.Record(journal.OpMove, src, dst)
+			logger.Pl.S("Moved muxed subtitle file %q → %q", src, dst)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/domain/paths"
+	"metarr/internal/plan"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+const swapDir = "swaps"
+
+// FFmpeg temp outputs being written or swapped in, which recovery must leave alone.
+var (
+	activeTempsMu sync.Mutex
+	activeTemps   = make(map[string]bool)
+)
+
+// swapManifest describes an in-progress video replacement, written before the original is touched.
+type swapManifest struct {
+	Original   string `json:"original"`
+	Swap       string `json:"swap"`
+	Temp       string `json:"temp"`
+	Final      string `json:"final"`
+	KeepBackup bool   `json:"keep_backup"`
+}
+
+// SwapInVideo crash-safely replaces the original video with FFmpeg's temp output.
+//
+// The original is kept under a recoverable name until the new file is in place, and a manifest in the
+// Metarr directory records the swap so RecoverSwaps can finish or roll it back after a crash.
+// Returns the backup path if the original was kept.
+func SwapInVideo(origPath, tmpPath, finalPath string, keepBackup bool) (backupPath string, err error) {
+	// Verify temp output before touching the original.
+	if err := syncFile(tmpPath); err != nil {
+		return "", fmt.Errorf("temp output %q failed verification: %w", tmpPath, err)
+	}
+
+	m := swapManifest{
+		Original:   origPath,
+		Swap:       generateSwapFilename(origPath),
+		Temp:       tmpPath,
+		Final:      finalPath,
+		KeepBackup: keepBackup,
+	}
+	manifestPath, err := writeSwapManifest(m)
+	if err != nil {
+		return "", err
+	}
+
+	// Move original aside.
+	if err := os.Rename(m.Original, m.Swap); err != nil {
+		removeSwapManifest(manifestPath)
+		return "", fmt.Errorf("failed to move original %q aside: %w", m.Original, err)
+	}
+
+	// Move temp output into place, rolling back on failure.
+	if err := os.Rename(m.Temp, m.Final); err != nil {
+		if rbErr := os.Rename(m.Swap, m.Original); rbErr != nil {
+			return "", fmt.Errorf("failed to move %q into place (%w) and failed to restore original from %q: %v", m.Temp, err, m.Swap, rbErr)
+		}
+		removeSwapManifest(manifestPath)
+		return "", fmt.Errorf("failed to move %q into place, original restored: %w", m.Temp, err)
+	}
+	syncDir(filepath.Dir(m.Final))
+
+	// New file is durable, dispose of the original.
+	if backupPath, err = finishSwap(m); err != nil {
+		return "", err
+	}
+	removeSwapManifest(manifestPath)
+	return backupPath, nil
+}
+
+// RecoverSwaps finishes or rolls back video swaps interrupted by a crash.
+func RecoverSwaps() error {
+	dir := filepath.Join(paths.HomeMetarrDir, swapDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read swap directory %q: %w", dir, err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != sharedconsts.MExtJSON {
+			continue
+		}
+		manifestPath := filepath.Join(dir, e.Name())
+
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			logger.Pl.E("Failed to read swap manifest %q: %v", manifestPath, err)
+			continue
+		}
+		var m swapManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			logger.Pl.E("Corrupt swap manifest %q, leaving in place for manual review: %v", manifestPath, err)
+			continue
+		}
+
+		if err := recoverSwap(m); err != nil {
+			logger.Pl.E("Could not recover interrupted swap of %q: %v", m.Original, err)
+			continue
+		}
+		removeSwapManifest(manifestPath)
+	}
+	return nil
+}
+
+// recoverSwap restores or completes a single interrupted swap.
+func recoverSwap(m swapManifest) error {
+	swapExists := exists(m.Swap)
+	tmpExists := exists(m.Temp)
+
+	switch {
+	case swapExists && (tmpExists || !exists(m.Final)):
+		// Crashed before the new file was moved into place: restore the original.
+		if err := os.Rename(m.Swap, m.Original); err != nil {
+			return fmt.Errorf("failed to restore original from %q: %w", m.Swap, err)
+		}
+		if tmpExists {
+			if err := os.Remove(m.Temp); err != nil {
+				logger.Pl.W("Failed to remove leftover temp file %q: %v", m.Temp, err)
+			}
+		}
+		logger.Pl.S("Recovered interrupted transcode: restored original %q", m.Original)
+
+	case swapExists:
+		// Crashed after the new file was moved into place: finish disposing of the original.
+		if _, err := finishSwap(m); err != nil {
+			return err
+		}
+		logger.Pl.S("Recovered interrupted transcode: completed swap to %q", m.Final)
+
+	case tmpExists && exists(m.Original):
+		// Crashed before the swap began: temp output is unverified.
+		if err := os.Remove(m.Temp); err != nil {
+			return fmt.Errorf("failed to remove leftover temp file %q: %w", m.Temp, err)
+		}
+		logger.Pl.I("Removed leftover temp file %q", m.Temp)
+	}
+	return nil
+}
+
+// finishSwap removes the moved-aside original, or renames it to a backup if requested.
+func finishSwap(m swapManifest) (backupPath string, err error) {
+	if m.KeepBackup {
+		backupPath = GenerateBackupFilename(m.Original)
+		if err := os.Rename(m.Swap, backupPath); err != nil {
+			return "", fmt.Errorf("failed to rename original %q to backup %q: %w", m.Swap, backupPath, err)
+		}
+		return backupPath, nil
+	}
+	if err := os.Remove(m.Swap); err != nil {
+		return "", fmt.Errorf("failed to remove original %q: %w", m.Swap, err)
+	}
+	return "", nil
+}
+
+// HoldTemp marks an FFmpeg temp output as in use until ReleaseTemp, so it isn't treated as leftover.
+func HoldTemp(tmpPath string) {
+	activeTempsMu.Lock()
+	defer activeTempsMu.Unlock()
+	activeTemps[filepath.Clean(tmpPath)] = true
+}
+
+// ReleaseTemp marks an FFmpeg temp output as no longer in use.
+func ReleaseTemp(tmpPath string) {
+	activeTempsMu.Lock()
+	defer activeTempsMu.Unlock()
+	delete(activeTemps, filepath.Clean(tmpPath))
+}
+
+// tempHeld returns true if a temp output is in use by a running job.
+func tempHeld(tmpPath string) bool {
+	activeTempsMu.Lock()
+	defer activeTempsMu.Unlock()
+	return activeTemps[filepath.Clean(tmpPath)]
+}
+
+// RecoverTempFiles handles leftover FFmpeg temp files from an interrupted run in a directory tree.
+//
+// Must run before discovery, temp files in use by a running job are skipped.
+func RecoverTempFiles(dir string) error {
+	files, err := newDirWalker(dir).walk()
+	if err != nil {
+		return fmt.Errorf("error reading directory %q: %w", dir, err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.name, consts.TempTag) {
+			recoverTempFile(f.path)
+		}
+	}
+	return nil
+}
+
+// recoverTempFile handles a leftover FFmpeg temp file.
+//
+// Temp files whose original still exists are incomplete and removed. Otherwise the temp file may be the
+// only remaining copy (e.g. from a crash in an older version), so it is moved to its final name.
+func recoverTempFile(tmpPath string) {
+	if plan.Enabled() {
+		logger.Pl.I("[dry-run] Skipping leftover temp file %q", tmpPath)
+		return
+	}
+	if tempHeld(tmpPath) {
+		logger.Pl.D(1, "Skipping temp file %q, it is in use", tmpPath)
+		return
+	}
+
+	// Temp files are named: tmp_<base><origExt><outExt>.
+	name := strings.TrimPrefix(filepath.Base(tmpPath), consts.TempTag)
+	outExt := filepath.Ext(name)
+	origName := strings.TrimSuffix(name, outExt)
+	origExt := filepath.Ext(origName)
+	if outExt == "" || origExt == "" {
+		return
+	}
+
+	dir := filepath.Dir(tmpPath)
+	origPath := filepath.Join(dir, origName)
+	finalPath := filepath.Join(dir, strings.TrimSuffix(origName, origExt)+outExt)
+
+	switch {
+	case exists(origPath):
+		if err := os.Remove(tmpPath); err != nil {
+			logger.Pl.E("Failed to remove leftover temp file %q: %v", tmpPath, err)
+			return
+		}
+		logger.Pl.I("Removed leftover temp file %q (original %q is intact)", tmpPath, origPath)
+
+	case exists(finalPath):
+		logger.Pl.W("Leftover temp file %q found but %q already exists, leaving both for manual review", tmpPath, finalPath)
+
+	default:
+		if err := os.Rename(tmpPath, finalPath); err != nil {
+			logger.Pl.E("Failed to recover leftover temp file %q: %v", tmpPath, err)
+			return
+		}
+		logger.Pl.W("Recovered leftover temp file %q as %q, its original was missing. Please verify it plays correctly.", tmpPath, finalPath)
+	}
+}
+
+// generateSwapFilename returns the name an original video is kept under during a swap.
+func generateSwapFilename(origPath string) string {
+	ext := filepath.Ext(origPath)
+	return strings.TrimSuffix(origPath, ext) + consts.SwapTag + ext
+}
+
+// writeSwapManifest durably writes a swap manifest and returns its path.
+func writeSwapManifest(m swapManifest) (string, error) {
+	dir := filepath.Join(paths.HomeMetarrDir, swapDir)
+	if err := os.MkdirAll(dir, consts.PermsHomeMetarrDir); err != nil {
+		return "", fmt.Errorf("failed to create swap directory: %w", err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal swap manifest: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(m.Original))
+	manifestPath := filepath.Join(dir, hex.EncodeToString(sum[:8])+sharedconsts.MExtJSON)
+	if err := os.WriteFile(manifestPath, data, consts.PermsJSONFile); err != nil {
+		return "", fmt.Errorf("failed to write swap manifest: %w", err)
+	}
+	if err := syncFile(manifestPath); err != nil {
+		return "", fmt.Errorf("failed to sync swap manifest: %w", err)
+	}
+	return manifestPath, nil
+}
+
+// removeSwapManifest deletes a completed swap manifest.
+func removeSwapManifest(manifestPath string) {
+	if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+		logger.Pl.E("Failed to remove swap manifest %q: %v", manifestPath, err)
+	}
+}
+
+// syncFile checks a file is a non-empty regular file and flushes it to disk.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Pl.E("Failed to close %q: %v", path, err)
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 {
+		return fmt.Errorf("%q is empty or not a regular file", path)
+	}
+	return f.Sync()
+}
+
+// syncDir flushes directory entries (renames) to disk where supported.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		logger.Pl.D(2, "Could not open directory %q to sync: %v", dir, err)
+		return
+	}
+	if err := d.Sync(); err != nil {
+		logger.Pl.D(2, "Could not sync directory %q: %v", dir, err)
+	}
+	if err := d.Close(); err != nil {
+		logger.Pl.E("Failed to close directory %q: %v", dir, err)
+	}
+}
+
+// exists returns true if a path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
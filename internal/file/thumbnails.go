@@ -0,0 +1,132 @@
+package file
+
+import (
+	"fmt"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/journal"
+	"metarr/internal/models"
+	"metarr/internal/parsing"
+	"metarr/internal/plan"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// thumbnailSidecarExts are the image extensions checked for local thumbnails, in priority order.
+var thumbnailSidecarExts = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// kodiThumbSuffix is the Kodi naming convention for a video's thumbnail ('<video>-thumb.jpg').
+const kodiThumbSuffix = "-thumb"
+
+// FindThumbnailSidecar returns an image beside the video sharing its base name ('Title.webp', 'Title-thumb.jpg'), or "".
+func FindThumbnailSidecar(videoPath string) string {
+	base := parsing.GetFilepathWithoutExt(videoPath)
+	for _, suffix := range []string{"", kodiThumbSuffix} {
+		for _, ext := range thumbnailSidecarExts {
+			if p := base + suffix + ext; exists(p) {
+				logger.Pl.I("Found local thumbnail %q for video %q", p, videoPath)
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// HandleThumbnailSidecar deletes an embedded local thumbnail or keeps it as '<video>-thumb.jpg', according to the user's setting.
+//
+// The JPG path is the image actually embedded (the sidecar itself, or a converted copy).
+func HandleThumbnailSidecar(fd *models.FileData, sidecar, jpgPath string) error {
+	if sidecar == "" {
+		return nil
+	}
+
+	switch abstractions.GetString(keys.ThumbnailSidecars) {
+	case "delete":
+		return deleteSidecar(fd, sidecar)
+
+	case "kodi":
+		target := kodiThumbPath(fd.PostFFmpegVideoPath)
+		fd.KodiThumbnail = target
+		if sidecar == target {
+			return nil
+		}
+
+		// Already a JPG, just rename.
+		if ext := strings.ToLower(filepath.Ext(sidecar)); ext == ".jpg" || ext == ".jpeg" {
+			if plan.Enabled() {
+				plan.AddOperation(fd, plan.OpRename, sidecar, target)
+				return nil
+			}
+			if err := moveOrCopyFile(sidecar, target); err != nil {
+				return fmt.Errorf("failed to rename thumbnail %q → %q: %w", sidecar, target, err)
+			}
+			journal.Record(journal.OpRename, sidecar, target)
+			logger.Pl.S("Kept thumbnail as %q", target)
+			return nil
+		}
+
+		// Keep the converted JPG and remove the original image.
+		if plan.Enabled() {
+			plan.AddOperation(fd, plan.OpConvert, sidecar, target)
+			return deleteSidecar(fd, sidecar)
+		}
+		if err := moveOrCopyFile(jpgPath, target); err != nil {
+			return fmt.Errorf("failed to save thumbnail %q → %q: %w", jpgPath, target, err)
+		}
+		journal.Record(journal.OpMove, jpgPath, target)
+		logger.Pl.S("Kept thumbnail as %q", target)
+		return deleteSidecar(fd, sidecar)
+	}
+	return nil
+}
+
+// MoveKodiThumbnail renames and moves a kept Kodi thumbnail to match the video's final path.
+func MoveKodiThumbnail(fd *models.FileData, finalVideoPath string) error {
+	src := fd.KodiThumbnail
+	if src == "" || finalVideoPath == "" {
+		return nil
+	}
+	dst := kodiThumbPath(finalVideoPath)
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return nil
+	}
+
+	if plan.Enabled() {
+		plan.AddOperation(fd, plan.OpMove, src, dst)
+		fd.KodiThumbnail = dst
+		return nil
+	}
+	if exists(dst) {
+		return fmt.Errorf("not moving thumbnail %q, %q already exists", src, dst)
+	}
+	if err := moveOrCopyFile(src, dst); err != nil {
+		return fmt.Errorf("failed to move thumbnail %q → %q: %w", src, dst, err)
+	}
+	journal.Record(journal.OpMove, src, dst)
+	fd.KodiThumbnail = dst
+	logger.Pl.S("Moved thumbnail to %q", dst)
+	return nil
+}
+
+// kodiThumbPath returns the Kodi thumbnail path for a video.
+func kodiThumbPath(videoPath string) string {
+	return parsing.GetFilepathWithoutExt(videoPath) + kodiThumbSuffix + ".jpg"
+}
+
+// deleteSidecar removes a file which has been embedded into the video, saving it for undo.
+func deleteSidecar(fd *models.FileData, path string) error {
+	if plan.Enabled() {
+		plan.AddOperation(fd, plan.OpDelete, path, "")
+		return nil
+	}
+	if err := journal.RecordDelete(path); err != nil {
+		return fmt.Errorf("not deleting %q, could not save it for undo: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("unable to delete %q: %w", path, err)
+	}
+	logger.Pl.S("Deleted embedded sidecar file %q", path)
+	return nil
+}
@@ -0,0 +1,130 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/journal"
+	"os"
+	"path/filepath"
+)
+
+// errIrreversible is returned for journal steps which can't be undone, and are skipped.
+var errIrreversible = errors.New("step cannot be undone")
+
+// UndoRun replays a run's journal in reverse, restoring paths and metafile contents.
+//
+// Steps which can't be reversed (transcodes with no backup) are skipped with a warning.
+func UndoRun(runID string) error {
+	entries, err := journal.Load(runID)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logger.Pl.I("Nothing to undo for run %q", runID)
+		return journal.MarkUndone(runID)
+	}
+
+	logger.Pl.I("Undoing %d operation(s) from run %q...", len(entries), runID)
+	failed, skipped := 0, 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		err := undoEntry(e)
+		switch {
+		case errors.Is(err, errIrreversible):
+			logger.Pl.W("Skipping %s of %q (step %d): %v", e.Op, e.Src, e.Seq, err)
+			skipped++
+		case err != nil:
+			logger.Pl.E("Could not undo %s of %q (step %d): %v", e.Op, e.Src, e.Seq, err)
+			failed++
+		}
+	}
+
+	// Leave the journal in place on failure so the undo can be retried.
+	if failed > 0 {
+		return fmt.Errorf("%d of %d operation(s) could not be undone for run %q", failed, len(entries), runID)
+	}
+	if skipped > 0 {
+		logger.Pl.W("Undid run %q, but %d step(s) could not be reversed", runID, skipped)
+	} else {
+		logger.Pl.S("Successfully undid run %q", runID)
+	}
+	return journal.MarkUndone(runID)
+}
+
+// undoEntry reverses a single journal entry. Steps which are already reversed are skipped.
+func undoEntry(e journal.Entry) error {
+	switch e.Op {
+	case journal.OpRename, journal.OpMove:
+		if alreadyRestored(e.Src, e.Dst) {
+			return nil
+		}
+		if _, err := os.Stat(e.Src); err == nil {
+			return fmt.Errorf("refusing to overwrite existing file %q", e.Src)
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Src), consts.PermsGenericDir); err != nil {
+			return err
+		}
+		if e.Op == journal.OpRename {
+			if err := os.Rename(e.Dst, e.Src); err != nil {
+				return err
+			}
+		} else if err := moveOrCopyFile(e.Dst, e.Src); err != nil {
+			return err
+		}
+		logger.Pl.S("Restored %q → %q", e.Dst, e.Src)
+
+	case journal.OpMkdir:
+		if err := os.Remove(e.Src); err != nil && !os.IsNotExist(err) {
+			logger.Pl.W("Leaving directory %q in place: %v", e.Src, err)
+		}
+
+	case journal.OpCreate:
+		if err := os.Remove(e.Src); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		logger.Pl.S("Removed created file %q", e.Src)
+
+	case journal.OpDelete, journal.OpRewrite:
+		data, err := os.ReadFile(e.Backup)
+		if err != nil {
+			return fmt.Errorf("failed to read saved copy %q: %w", e.Backup, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Src), consts.PermsGenericDir); err != nil {
+			return err
+		}
+		if err := os.WriteFile(e.Src, data, consts.PermsJSONFile); err != nil {
+			return err
+		}
+		logger.Pl.S("Restored contents of %q", e.Src)
+
+	case journal.OpTranscode:
+		if e.Irreversible || e.Backup == "" {
+			return fmt.Errorf("%w: original video was replaced by %q and no backup was kept (use --no-file-overwrite to keep one)", errIrreversible, e.Dst)
+		}
+		if alreadyRestored(e.Src, e.Backup) {
+			return nil
+		}
+		if e.Dst != e.Src {
+			if err := os.Remove(e.Dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(e.Backup, e.Src); err != nil {
+			return err
+		}
+		logger.Pl.S("Restored original video %q", e.Src)
+
+	default:
+		return fmt.Errorf("unknown journal operation %q", e.Op)
+	}
+	return nil
+}
+
+// alreadyRestored checks whether a file was already moved back from dst to src (src exists and dst is gone).
+func alreadyRestored(src, dst string) bool {
+	_, srcErr := os.Stat(src)
+	_, dstErr := os.Stat(dst)
+	return srcErr == nil && errors.Is(dstErr, os.ErrNotExist)
+}
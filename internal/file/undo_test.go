@@ -0,0 +1,219 @@
+package file
+
+import (
+	"metarr/internal/domain/paths"
+	"metarr/internal/journal"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUndoRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string // Files present before the run.
+		run        func(t *testing.T, dir string)
+		want       map[string]string // Files expected after undo.
+		gone       []string          // Files expected to be removed by undo.
+		wantErr    bool
+		wantUndone bool
+	}{
+		{
+			name:  "rename",
+			files: map[string]string{"Title.mp4": "video"},
+			run: func(t *testing.T, dir string) {
+				mustRename(t, filepath.Join(dir, "Title.mp4"), filepath.Join(dir, "New Title.mp4"))
+				journal.Record(journal.OpRename, filepath.Join(dir, "Title.mp4"), filepath.Join(dir, "New Title.mp4"))
+			},
+			want:       map[string]string{"Title.mp4": "video"},
+			gone:       []string{"New Title.mp4"},
+			wantUndone: true,
+		},
+		{
+			name:  "move into a directory which was created",
+			files: map[string]string{"in/Title.mp4": "video"},
+			run: func(t *testing.T, dir string) {
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				journal.Record(journal.OpMkdir, out, "")
+				mustRename(t, filepath.Join(dir, "in/Title.mp4"), filepath.Join(out, "Title.mp4"))
+				journal.Record(journal.OpMove, filepath.Join(dir, "in/Title.mp4"), filepath.Join(out, "Title.mp4"))
+			},
+			want:       map[string]string{"in/Title.mp4": "video"},
+			gone:       []string{"out/Title.mp4", "out"},
+			wantUndone: true,
+		},
+		{
+			name:  "renames are reversed in order",
+			files: map[string]string{"a.mp4": "video"},
+			run: func(t *testing.T, dir string) {
+				mustRename(t, filepath.Join(dir, "a.mp4"), filepath.Join(dir, "b.mp4"))
+				journal.Record(journal.OpRename, filepath.Join(dir, "a.mp4"), filepath.Join(dir, "b.mp4"))
+				mustRename(t, filepath.Join(dir, "b.mp4"), filepath.Join(dir, "c.mp4"))
+				journal.Record(journal.OpRename, filepath.Join(dir, "b.mp4"), filepath.Join(dir, "c.mp4"))
+			},
+			want:       map[string]string{"a.mp4": "video"},
+			gone:       []string{"b.mp4", "c.mp4"},
+			wantUndone: true,
+		},
+		{
+			name: "created file",
+			run: func(t *testing.T, dir string) {
+				mustWrite(t, filepath.Join(dir, "Title.nfo"), "nfo")
+				journal.Record(journal.OpCreate, filepath.Join(dir, "Title.nfo"), "")
+			},
+			gone:       []string{"Title.nfo"},
+			wantUndone: true,
+		},
+		{
+			name:  "rewritten metafile",
+			files: map[string]string{"Title.json": "original"},
+			run: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, "Title.json")
+				if err := journal.RecordRewrite(path); err != nil {
+					t.Fatal(err)
+				}
+				mustWrite(t, path, "first")
+				if err := journal.RecordRewrite(path); err != nil {
+					t.Fatal(err)
+				}
+				mustWrite(t, path, "second")
+			},
+			want:       map[string]string{"Title.json": "original"},
+			wantUndone: true,
+		},
+		{
+			name:  "deleted metafile",
+			files: map[string]string{"Title.json": "original"},
+			run: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, "Title.json")
+				if err := journal.RecordDelete(path); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:       map[string]string{"Title.json": "original"},
+			wantUndone: true,
+		},
+		{
+			name:  "transcode with a backup",
+			files: map[string]string{"Title.mp4": "original"},
+			run: func(t *testing.T, dir string) {
+				orig := filepath.Join(dir, "Title.mp4")
+				backup := filepath.Join(dir, "Title.backup.mp4")
+				mustRename(t, orig, backup)
+				mustWrite(t, filepath.Join(dir, "Title.mkv"), "transcoded")
+				journal.RecordTranscode(orig, filepath.Join(dir, "Title.mkv"), backup)
+			},
+			want:       map[string]string{"Title.mp4": "original"},
+			gone:       []string{"Title.mkv", "Title.backup.mp4"},
+			wantUndone: true,
+		},
+		{
+			name:  "transcode without a backup is skipped",
+			files: map[string]string{"Title.mp4": "original"},
+			run: func(t *testing.T, dir string) {
+				orig := filepath.Join(dir, "Title.mp4")
+				mustRename(t, orig, filepath.Join(dir, "Title.mkv"))
+				journal.RecordTranscode(orig, filepath.Join(dir, "Title.mkv"), "")
+				mustRename(t, filepath.Join(dir, "Title.mkv"), filepath.Join(dir, "New.mkv"))
+				journal.Record(journal.OpRename, filepath.Join(dir, "Title.mkv"), filepath.Join(dir, "New.mkv"))
+			},
+			want:       map[string]string{"Title.mkv": "original"},
+			gone:       []string{"New.mkv"},
+			wantUndone: true,
+		},
+		{
+			name:  "already restored",
+			files: map[string]string{"Title.mp4": "video"},
+			run: func(t *testing.T, dir string) {
+				journal.Record(journal.OpRename, filepath.Join(dir, "Title.mp4"), filepath.Join(dir, "New Title.mp4"))
+			},
+			want:       map[string]string{"Title.mp4": "video"},
+			wantUndone: true,
+		},
+		{
+			name:  "refuses to overwrite",
+			files: map[string]string{"Title.mp4": "video"},
+			run: func(t *testing.T, dir string) {
+				mustRename(t, filepath.Join(dir, "Title.mp4"), filepath.Join(dir, "New Title.mp4"))
+				journal.Record(journal.OpRename, filepath.Join(dir, "Title.mp4"), filepath.Join(dir, "New Title.mp4"))
+				mustWrite(t, filepath.Join(dir, "Title.mp4"), "another video")
+			},
+			want:    map[string]string{"Title.mp4": "another video", "New Title.mp4": "video"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldHome := paths.HomeMetarrDir
+			paths.HomeMetarrDir = t.TempDir()
+			defer func() { paths.HomeMetarrDir = oldHome }()
+
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				mustWrite(t, filepath.Join(dir, name), content)
+			}
+
+			runID, err := journal.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.run(t, dir)
+			if err := journal.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := UndoRun(runID); (err != nil) != tt.wantErr {
+				t.Fatalf("UndoRun() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				} else if string(got) != want {
+					t.Errorf("%s contains %q, want %q", name, got, want)
+				}
+			}
+			for _, name := range tt.gone {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists after undo", name)
+				}
+			}
+
+			pending, err := journal.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if undone := !slices.Contains(pending, runID); undone != tt.wantUndone {
+				t.Errorf("run marked undone = %v, want %v", undone, tt.wantUndone)
+			}
+		})
+	}
+}
+
+// mustWrite writes a file, failing the test on error.
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustRename renames a file, failing the test on error.
+func mustRename(t *testing.T, src, dst string) {
+	t.Helper()
+	if err := os.Rename(src, dst); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/domain/paths"
+	"metarr/internal/journal"
+	"metarr/internal/models"
+	"metarr/internal/plan"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pairingReportDir holds the per-batch JSON reports of unpaired files, inside the Metarr home directory.
+const pairingReportDir = "pairing"
+
+// QuarantineOrphans moves orphan metafiles into the quarantine directory, keeping their path relative to the metadata directory.
+func QuarantineOrphans(report *models.MatchReport, metaRoot, quarantineDir string) error {
+	if report == nil || len(report.Orphans) == 0 || quarantineDir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(quarantineDir) {
+		quarantineDir = filepath.Join(metaRoot, quarantineDir)
+	}
+
+	madeDirs := make(map[string]bool)
+	for i := range report.Orphans {
+		o := &report.Orphans[i]
+		rel, err := filepath.Rel(metaRoot, o.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(o.Path)
+		}
+		dst := filepath.Join(quarantineDir, rel)
+		if exists(dst) {
+			logger.Pl.W("Not quarantining %q, %q already exists", o.Path, dst)
+			continue
+		}
+
+		// Create the target directory.
+		fd := &models.FileData{MetaFilePath: o.Path}
+		dir := filepath.Dir(dst)
+		if !madeDirs[dir] && !exists(dir) {
+			if plan.Enabled() {
+				plan.AddOperation(fd, plan.OpMkdir, dir, "")
+			} else {
+				if err := os.MkdirAll(dir, consts.PermsGenericDir); err != nil {
+					return fmt.Errorf("failed to create quarantine directory %q: %w", dir, err)
+				}
+				journal.Record(journal.OpMkdir, dir, "")
+			}
+		}
+		madeDirs[dir] = true
+
+		if plan.Enabled() {
+			plan.AddOperation(fd, plan.OpMove, o.Path, dst)
+			o.QuarantinedTo = dst
+			continue
+		}
+		if err := moveOrCopyFile(o.Path, dst); err != nil {
+			return fmt.Errorf("failed to quarantine %q → %q: %w", o.Path, dst, err)
+		}
+		journal.Record(journal.OpMove, o.Path, dst)
+		o.QuarantinedTo = dst
+		logger.Pl.S("Quarantined orphan metafile %q → %q", o.Path, dst)
+	}
+	return nil
+}
+
+// WritePairingReport saves a batch's report of unpaired files as JSON, returning its path.
+func WritePairingReport(report *models.MatchReport) (string, error) {
+	dir := filepath.Join(paths.HomeMetarrDir, pairingReportDir)
+	if err := os.MkdirAll(dir, consts.PermsHomeMetarrDir); err != nil {
+		return "", fmt.Errorf("failed to create pairing report directory: %w", err)
+	}
+
+	// Named after the run's journal where there is one (not in dry runs).
+	id := journal.RunID()
+	if id == "" {
+		id = time.Now().Format("20060102-150405") + "-" + strconv.Itoa(os.Getpid())
+	}
+	path := filepath.Join(dir, id+"-batch"+strconv.FormatInt(report.BatchID, 10)+".json")
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pairing report: %w", err)
+	}
+	if err := os.WriteFile(path, data, consts.PermsJSONFile); err != nil {
+		return "", fmt.Errorf("failed to write pairing report %q: %w", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,160 @@
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"os"
+	"path/filepath"
+)
+
+// walkEntry is a regular file found while walking a directory tree.
+type walkEntry struct {
+	path string // Full path to the file.
+	rel  string // Path relative to the walked root (used as the map key).
+	name string // Base filename.
+}
+
+// dirWalker recursively walks a directory tree honoring depth, symlink, and exclusion settings.
+type dirWalker struct {
+	root           string
+	maxDepth       int
+	followSymlinks bool
+	excludes       []string
+	skipDirs       map[string]bool
+	visited        map[string]bool
+	entries        []walkEntry
+}
+
+// newDirWalker returns a walker for the given root using the user's recursion settings.
+func newDirWalker(root string) *dirWalker {
+	w := &dirWalker{
+		root:           filepath.Clean(root),
+		maxDepth:       -1,
+		followSymlinks: abstractions.GetBool(keys.FollowSymlinks),
+		skipDirs:       make(map[string]bool),
+		visited:        make(map[string]bool),
+	}
+	if abstractions.IsSet(keys.MaxDepth) {
+		w.maxDepth = abstractions.GetInt(keys.MaxDepth)
+	}
+	if abstractions.IsSet(keys.ExcludeDirs) {
+		w.excludes = abstractions.GetStringSlice(keys.ExcludeDirs)
+	}
+
+	// Never descend into the output directory if it sits inside the tree.
+	if outDir := abstractions.GetString(keys.OutputDirectory); outDir != "" {
+		if abs, err := filepath.Abs(outDir); err == nil {
+			w.skipDirs[abs] = true
+		}
+	}
+
+	// Or into the quarantine directory for orphan metafiles.
+	if q := abstractions.GetString(keys.QuarantineDir); q != "" {
+		if !filepath.IsAbs(q) {
+			q = filepath.Join(w.root, q)
+		}
+		if abs, err := filepath.Abs(q); err == nil {
+			w.skipDirs[abs] = true
+		}
+	}
+	return w
+}
+
+// walk collects all regular files under the root.
+func (w *dirWalker) walk() ([]walkEntry, error) {
+	if err := w.walkDir(w.root, 0); err != nil {
+		return nil, err
+	}
+	return w.entries, nil
+}
+
+// walkDir reads a single directory and recurses into subdirectories.
+func (w *dirWalker) walkDir(dir string, depth int) error {
+	// Guard against symlink loops.
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if w.visited[real] {
+			logger.Pl.D(2, "Skipping already visited directory %q", dir)
+			return nil
+		}
+		w.visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Subdirectory read failures should not abort the whole walk.
+		if depth > 0 {
+			logger.Pl.W("Could not read directory %q: %v", dir, err)
+			return nil
+		}
+		return fmt.Errorf("error reading directory %q: %w", dir, err)
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		isDir := e.IsDir()
+
+		// Resolve symlinks.
+		if e.Type()&fs.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				logger.Pl.D(3, "Skipping symlink %q", path)
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				logger.Pl.W("Skipping broken symlink %q: %v", path, err)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil {
+			rel = e.Name()
+		}
+
+		if isDir {
+			if w.maxDepth >= 0 && depth >= w.maxDepth {
+				continue
+			}
+			if w.isExcluded(path, rel, e.Name()) {
+				logger.Pl.D(1, "Excluding directory %q", path)
+				continue
+			}
+			if err := w.walkDir(path, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isHeld(path) {
+			logger.Pl.D(1, "Skipping %q, its pair is still being written", path)
+			continue
+		}
+
+		w.entries = append(w.entries, walkEntry{
+			path: path,
+			rel:  rel,
+			name: e.Name(),
+		})
+	}
+	return nil
+}
+
+// isExcluded checks whether a directory should be skipped.
+func (w *dirWalker) isExcluded(path, rel, name string) bool {
+	if abs, err := filepath.Abs(path); err == nil && w.skipDirs[abs] {
+		return true
+	}
+	for _, pattern := range w.excludes {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -7,11 +7,16 @@ import (
 	"metarr/internal/domain/enums"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
+	"metarr/internal/domain/vars"
+	"metarr/internal/journal"
 	"metarr/internal/models"
+	"metarr/internal/plan"
+	"metarr/internal/report"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/TubarrApp/gocommon/logging"
 	"github.com/TubarrApp/gocommon/sharedconsts"
@@ -71,33 +76,52 @@ func NewFSFileWriter(fd *models.FileData, skipVids bool, outputDir string) (*FSF
 }
 
 // RenameFiles calls os.Rename on the video/meta files.
-func (fs *FSFileWriter) RenameFiles() error {
+func (fs *FSFileWriter) RenameFiles() (err error) {
 	fs.muFs.Lock()
 	defer fs.muFs.Unlock()
 
+	start, renamed := time.Now(), false
+	defer func() {
+		if renamed || err != nil {
+			report.AddStage(fs.Fd, report.StageRename, start, err)
+		}
+	}()
+
 	// Rename video file.
 	if shouldProcess(fs.InputVideo, fs.RenamedVideo, true, fs.SkipVids) {
-		if err := os.Rename(fs.InputVideo, fs.RenamedVideo); err != nil {
-			return fmt.Errorf("failed to rename %s → %s. error: %w", fs.InputVideo, fs.RenamedVideo, err)
+		if plan.Enabled() {
+			plan.AddOperation(fs.Fd, plan.OpRename, fs.InputVideo, fs.RenamedVideo)
+		} else {
+			if err := os.Rename(fs.InputVideo, fs.RenamedVideo); err != nil {
+				return fmt.Errorf("failed to rename %s → %s. error: %w", fs.InputVideo, fs.RenamedVideo, err)
+			}
+			journal.Record(journal.OpRename, fs.InputVideo, fs.RenamedVideo)
+			logger.Pl.S("Renamed: %q → %q", fs.InputVideo, fs.RenamedVideo)
 		}
-		logger.Pl.S("Renamed: %q → %q", fs.InputVideo, fs.RenamedVideo)
 		fs.Fd.RenamedVideoPath = fs.RenamedVideo
+		renamed = true
 	}
 
 	// Rename meta file.
 	if shouldProcess(fs.InputMeta, fs.RenamedMeta, false, fs.SkipVids) {
-		if err := os.Rename(fs.InputMeta, fs.RenamedMeta); err != nil {
-			return fmt.Errorf("failed to rename %s → %s. error: %w", fs.InputMeta, fs.RenamedMeta, err)
+		if plan.Enabled() {
+			plan.AddOperation(fs.Fd, plan.OpRename, fs.InputMeta, fs.RenamedMeta)
+		} else {
+			if err := os.Rename(fs.InputMeta, fs.RenamedMeta); err != nil {
+				return fmt.Errorf("failed to rename %s → %s. error: %w", fs.InputMeta, fs.RenamedMeta, err)
+			}
+			journal.Record(journal.OpRename, fs.InputMeta, fs.RenamedMeta)
+			logger.Pl.S("Renamed: %q → %q", fs.InputMeta, fs.RenamedMeta)
 		}
-		logger.Pl.S("Renamed: %q → %q", fs.InputMeta, fs.RenamedMeta)
 		fs.Fd.RenamedMetaPath = fs.RenamedMeta
+		renamed = true
 	}
 
 	return nil
 }
 
 // MoveFile moves files to specified location with new names.
-func (fs *FSFileWriter) MoveFile(noMeta bool) error {
+func (fs *FSFileWriter) MoveFile(noMeta bool) (err error) {
 	fs.muFs.Lock()
 	defer fs.muFs.Unlock()
 
@@ -110,10 +134,33 @@ func (fs *FSFileWriter) MoveFile(noMeta bool) error {
 		return nil
 	}
 
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			err = vars.NewError(vars.ErrMove, "", err)
+		}
+		report.AddStage(fs.Fd, report.StageMove, start, err)
+	}()
+
+	// Record moves instead of performing them in dry-run mode.
+	if plan.Enabled() {
+		if _, err := os.Stat(fs.OutputDir); os.IsNotExist(err) {
+			plan.AddOperation(fs.Fd, plan.OpMkdir, fs.OutputDir, "")
+		}
+		if !fs.SkipVids && fs.InputVideo != "" && fs.RenamedVideo != "" {
+			plan.AddOperation(fs.Fd, plan.OpMove, fs.InputVideo, fs.RenamedVideo)
+		}
+		if !noMeta && fs.InputMeta != "" && fs.RenamedMeta != "" {
+			plan.AddOperation(fs.Fd, plan.OpMove, fs.InputMeta, fs.RenamedMeta)
+		}
+		return nil
+	}
+
 	if _, err := os.Stat(fs.OutputDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(fs.OutputDir, 0o755); err != nil {
 			return fmt.Errorf("failed to create or find destination directory: %w", err)
 		}
+		journal.Record(journal.OpMkdir, fs.OutputDir, "")
 	}
 
 	// Move+rename video directly from original location to output directory.
@@ -122,6 +169,7 @@ func (fs *FSFileWriter) MoveFile(noMeta bool) error {
 			if err := moveOrCopyFile(fs.InputVideo, fs.RenamedVideo); err != nil {
 				return fmt.Errorf("failed to move video file from %q → %q: %w", fs.InputVideo, fs.RenamedVideo, err)
 			}
+			journal.Record(journal.OpMove, fs.InputVideo, fs.RenamedVideo)
 		}
 	}
 
@@ -131,6 +179,7 @@ func (fs *FSFileWriter) MoveFile(noMeta bool) error {
 			if err := moveOrCopyFile(fs.InputMeta, fs.RenamedMeta); err != nil {
 				return fmt.Errorf("failed to move metadata file from %q → %q: %w", fs.InputMeta, fs.RenamedMeta, err)
 			}
+			journal.Record(journal.OpMove, fs.InputMeta, fs.RenamedMeta)
 		}
 	}
 	return nil
@@ -138,6 +187,13 @@ func (fs *FSFileWriter) MoveFile(noMeta bool) error {
 
 // DeleteMetafile safely removes metadata files once file operations are complete.
 func (fs *FSFileWriter) DeleteMetafile(file string) (deleted bool, err error) {
+	start := time.Now()
+	defer func() {
+		if deleted || err != nil {
+			report.AddStage(fs.Fd, report.StagePurge, start, err)
+		}
+	}()
+
 	if !abstractions.IsSet(keys.MetaPurgeEnum) {
 		return false, errors.New("meta purge enum not set")
 	}
@@ -186,6 +242,14 @@ func (fs *FSFileWriter) DeleteMetafile(file string) (deleted bool, err error) {
 		return false, fmt.Errorf("metafile %q is not a regular file", file)
 	}
 
+	if plan.Enabled() {
+		plan.AddOperation(fs.Fd, plan.OpDelete, file, "")
+		return true, nil
+	}
+
+	if err := journal.RecordDelete(file); err != nil {
+		return false, fmt.Errorf("not deleting meta file, could not save it for undo: %w", err)
+	}
 	if err := os.Remove(file); err != nil {
 		return false, fmt.Errorf("unable to delete meta file: %w", err)
 	}
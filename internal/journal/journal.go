@@ -0,0 +1,310 @@
+// Package journal records the filesystem changes made during a run so they can be undone later.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/domain/paths"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	journalDir   = "journal"
+	journalExt   = ".jsonl"
+	undoneSuffix = ".undone"
+)
+
+// Journal operations.
+const (
+	OpRename    = "rename"    // Src renamed to Dst.
+	OpMove      = "move"      // Src moved (or copied and removed) to Dst.
+	OpMkdir     = "mkdir"     // Directory Src created.
+	OpDelete    = "delete"    // Src deleted, prior contents saved at Backup.
+	OpRewrite   = "rewrite"   // Src rewritten in place, prior contents saved at Backup.
+	OpTranscode = "transcode" // Video Src replaced by Dst, original kept at Backup if one was made.
+	OpCreate    = "create"    // File Src created by Metarr.
+)
+
+// Entry is a single recorded filesystem change.
+type Entry struct {
+	Seq    int       `json:"seq"`
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst,omitempty"`
+	Backup string    `json:"backup,omitempty"`
+
+	// Irreversible is set for steps undo can't reverse (e.g. a transcode with no backup of the original).
+	Irreversible bool `json:"irreversible,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	runID    string
+	jFile    *os.File
+	seq      int
+	snapshot map[string]bool
+	hook     func(Entry)
+)
+
+// SetHook calls fn with every entry recorded from now on (nil to stop).
+//
+// fn is called while the journal is locked, so it must not record entries itself.
+func SetHook(fn func(Entry)) {
+	mu.Lock()
+	defer mu.Unlock()
+	hook = fn
+}
+
+// Start begins a new journal for this run and returns its ID.
+func Start() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir := filepath.Join(paths.HomeMetarrDir, journalDir)
+	if err := os.MkdirAll(dir, consts.PermsHomeMetarrDir); err != nil {
+		return "", fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	id := time.Now().Format("20060102-150405") + "-" + strconv.Itoa(os.Getpid())
+	f, err := os.OpenFile(filepath.Join(dir, id+journalExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, consts.PermsJSONFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	runID = id
+	jFile = f
+	seq = 0
+	snapshot = make(map[string]bool)
+	return id, nil
+}
+
+// RunID returns the ID of the current run's journal (empty if not started).
+func RunID() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return runID
+}
+
+// Close closes the journal, removing it if nothing was recorded.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if jFile == nil {
+		return nil
+	}
+	name := jFile.Name()
+	err := jFile.Close()
+	jFile = nil
+
+	if seq == 0 {
+		if rmErr := os.Remove(name); rmErr != nil && !os.IsNotExist(rmErr) {
+			logger.Pl.E("Failed to remove empty journal %q: %v", name, rmErr)
+		}
+	}
+	return err
+}
+
+// Record appends an operation to the journal. No-op if no journal is open.
+func Record(op, src, dst string) {
+	mu.Lock()
+	defer mu.Unlock()
+	write(Entry{Op: op, Src: src, Dst: dst})
+}
+
+// RecordDelete saves the contents of a file about to be deleted and records the deletion.
+func RecordDelete(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if jFile == nil {
+		return nil
+	}
+	backup, err := saveCopy(path)
+	if err != nil {
+		return err
+	}
+	write(Entry{Op: OpDelete, Src: path, Backup: backup})
+	return nil
+}
+
+// RecordRewrite saves the contents of a file about to be rewritten in place.
+//
+// Only the first rewrite of a path per run is saved, since that holds the original contents.
+func RecordRewrite(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if jFile == nil || snapshot[path] {
+		return nil
+	}
+	backup, err := saveCopy(path)
+	if err != nil {
+		return err
+	}
+	snapshot[path] = true
+	write(Entry{Op: OpRewrite, Src: path, Backup: backup})
+	return nil
+}
+
+// RecordTranscode records a video replaced by FFmpeg output.
+func RecordTranscode(origPath, newPath, backupPath string) {
+	mu.Lock()
+	defer mu.Unlock()
+	write(Entry{Op: OpTranscode, Src: origPath, Dst: newPath, Backup: backupPath, Irreversible: backupPath == ""})
+}
+
+// Load reads all entries for a run.
+func Load(id string) ([]Entry, error) {
+	path, err := journalPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal for run %q: %w", id, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Pl.E("Failed to close journal %q: %v", f.Name(), err)
+		}
+	}()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			// A crash may leave a partial final line.
+			logger.Pl.W("Skipping unreadable journal line in %q: %v", path, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %q: %w", path, err)
+	}
+	return entries, nil
+}
+
+// MarkUndone flags a run's journal as undone so it isn't replayed twice.
+func MarkUndone(id string) error {
+	path, err := journalPath(id)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, strings.TrimSuffix(path, journalExt)+undoneSuffix+journalExt)
+}
+
+// List returns the IDs of runs which can be undone, oldest first.
+func List() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(paths.HomeMetarrDir, journalDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, journalExt) || strings.HasSuffix(name, undoneSuffix+journalExt) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, journalExt))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// journalPath returns the path to a run's journal file.
+func journalPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid run ID %q", id)
+	}
+	path := filepath.Join(paths.HomeMetarrDir, journalDir, id+journalExt)
+	if _, err := os.Stat(path); err != nil {
+		if _, undoneErr := os.Stat(strings.TrimSuffix(path, journalExt) + undoneSuffix + journalExt); undoneErr == nil {
+			return "", fmt.Errorf("run %q has already been undone", id)
+		}
+		return "", fmt.Errorf("no journal found for run %q", id)
+	}
+	return path, nil
+}
+
+// write appends an entry to the journal file. Must be called under lock.
+func write(e Entry) {
+	if jFile == nil {
+		return
+	}
+	seq++
+	e.Seq = seq
+	e.Time = time.Now()
+
+	// Undo may run from a different working directory.
+	e.Src = absPath(e.Src)
+	e.Dst = absPath(e.Dst)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Pl.E("Failed to marshal journal entry: %v", err)
+		return
+	}
+	if _, err := jFile.Write(append(data, '\n')); err != nil {
+		logger.Pl.E("Failed to write journal entry for %q: %v", e.Src, err)
+		return
+	}
+	if err := jFile.Sync(); err != nil {
+		logger.Pl.E("Failed to sync journal: %v", err)
+	}
+	if hook != nil {
+		hook(e)
+	}
+}
+
+// saveCopy stores a copy of a file in the run's journal directory. Must be called under lock.
+func saveCopy(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %q for journal: %w", path, err)
+	}
+
+	dir := filepath.Join(paths.HomeMetarrDir, journalDir, runID)
+	if err := os.MkdirAll(dir, consts.PermsHomeMetarrDir); err != nil {
+		return "", fmt.Errorf("failed to create journal backup directory: %w", err)
+	}
+
+	backup := filepath.Join(dir, strconv.Itoa(seq+1)+"_"+filepath.Base(path))
+	if err := os.WriteFile(backup, data, consts.PermsJSONFile); err != nil {
+		return "", fmt.Errorf("failed to save journal copy of %q: %w", path, err)
+	}
+	return backup, nil
+}
+
+// absPath returns the absolute form of a path, or the path unchanged if empty or unresolvable.
+func absPath(p string) string {
+	if p == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
@@ -0,0 +1,177 @@
+// Package fieldsfilename fills metafields missing from the metafile using patterns matched against the filename.
+package fieldsfilename
+
+import (
+	"metarr/internal/abstractions"
+	"metarr/internal/dates"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/file"
+	"metarr/internal/models"
+	"metarr/internal/parsing"
+	"metarr/internal/utils/printout"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/TubarrApp/gocommon/sharedtags"
+)
+
+// Parse matches the file's name against the user's filename patterns, returning the captured fields.
+//
+// The first matching pattern wins. Returns nil if no patterns are set or none match.
+func Parse(fd *models.FileData) map[string]string {
+	patterns, ok := abstractions.Get(keys.FilenamePatternModels).([]*regexp.Regexp)
+	if !ok || len(patterns) == 0 {
+		return nil
+	}
+
+	var name string
+	if fd.OriginalVideoPath != "" {
+		name = parsing.GetBaseNameWithoutExt(fd.OriginalVideoPath)
+	} else {
+		name = file.TrimMetafileSuffixes(filepath.Base(fd.MetaFilePath), "")
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	for _, rx := range patterns {
+		match := rx.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		fields := make(map[string]string, len(match))
+		for i, group := range rx.SubexpNames() {
+			if group == "" {
+				continue
+			}
+			if v := strings.TrimSpace(match[i]); v != "" {
+				fields[strings.ToLower(group)] = v
+			}
+		}
+		logger.Pl.D(1, "Filename %q matched pattern %q: %v", name, rx, fields)
+		return fields
+	}
+	logger.Pl.D(1, "No filename pattern matched %q", name)
+	return nil
+}
+
+// FillDates fills empty date fields from a date captured in the filename.
+func FillDates(fd *models.FileData, fields map[string]string) (filled bool) {
+	if len(fields) == 0 {
+		return false
+	}
+	t := fd.MDates
+
+	fieldMap := map[string]*string{
+		sharedtags.JUploadDate:  &t.UploadDate,
+		sharedtags.JReleaseDate: &t.ReleaseDate,
+		sharedtags.JDate:        &t.Date,
+	}
+
+	var parsed string
+	printMap := make(map[string]string, len(fieldMap))
+	for k, ptr := range fieldMap {
+		raw, ok := fields[k]
+		if !ok || *ptr != "" {
+			continue
+		}
+		date, err := dates.ParseWordDate(raw)
+		if err != nil {
+			logger.Pl.W("Ignoring %s %q from filename: %v", k, raw, err)
+			continue
+		}
+		*ptr = date
+		printMap[k] = date
+		parsed = date
+	}
+	if year, ok := fields[sharedtags.JYear]; ok && t.Year == "" && len(year) == 4 {
+		t.Year = year
+		printMap[sharedtags.JYear] = year
+	}
+	if len(printMap) == 0 {
+		return false
+	}
+
+	// Fill the remaining empty dates from the parsed one.
+	if parsed != "" {
+		for _, ptr := range []*string{&t.ReleaseDate, &t.Date, &t.UploadDate, &t.OriginallyAvailableAt} {
+			if *ptr == "" {
+				*ptr = parsed
+			}
+		}
+		if t.Year == "" {
+			t.Year = parsed[:4]
+		}
+		if t.FormattedDate == "" {
+			dates.FormatAllDates(fd)
+		}
+	}
+
+	if logging.Level > 1 {
+		printout.PrintGrabbedFields("dates (filename)", printMap)
+	}
+	return true
+}
+
+// FillFields fills empty title, credits and show fields from the filename.
+func FillFields(fd *models.FileData, fields map[string]string) (filled bool) {
+	if len(fields) == 0 {
+		return false
+	}
+	t := fd.MTitleDesc
+	c := fd.MCredits
+	s := fd.MShowData
+
+	fieldMap := map[string]*string{
+		// Titles and descriptions.
+		sharedtags.JTitle:       &t.Title,
+		sharedtags.JFulltitle:   &t.Fulltitle,
+		sharedtags.JSubtitle:    &t.Subtitle,
+		sharedtags.JDescription: &t.Description,
+		sharedtags.JSynopsis:    &t.Synopsis,
+		sharedtags.JSummary:     &t.Summary,
+		sharedtags.JComment:     &t.Comment,
+
+		// Credits.
+		sharedtags.JActor:     &c.Actor,
+		sharedtags.JAuthor:    &c.Author,
+		sharedtags.JArtist:    &c.Artist,
+		sharedtags.JChannel:   &c.Channel,
+		sharedtags.JCreator:   &c.Creator,
+		sharedtags.JStudio:    &c.Studio,
+		sharedtags.JPublisher: &c.Publisher,
+		sharedtags.JProducer:  &c.Producer,
+		sharedtags.JPerformer: &c.Performer,
+		sharedtags.JUploader:  &c.Uploader,
+		sharedtags.JComposer:  &c.Composer,
+		sharedtags.JDirector:  &c.Director,
+		sharedtags.JWriter:    &c.Writer,
+
+		// Show data.
+		"show":          &s.Show,
+		"episode_id":    &s.EpisodeID,
+		"episode_sort":  &s.EpisodeSort,
+		"season_number": &s.SeasonNumber,
+		"season_title":  &s.SeasonTitle,
+	}
+
+	printMap := make(map[string]string, len(fields))
+	for k, ptr := range fieldMap {
+		if v, ok := fields[k]; ok && *ptr == "" {
+			*ptr = v
+			printMap[k] = v
+			filled = true
+		}
+	}
+
+	// Fulltitle mirrors title when only one was captured.
+	if t.Fulltitle == "" && printMap[sharedtags.JTitle] != "" {
+		t.Fulltitle = t.Title
+	}
+
+	if filled && logging.Level > 1 {
+		printout.PrintGrabbedFields("filename", printMap)
+	}
+	return filled
+}
@@ -15,6 +15,7 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/file"
+	"metarr/internal/journal"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
 	"metarr/internal/utils/prompt"
@@ -782,6 +783,11 @@ func (rw *JSONFileRW) writeJSONToFile(file *os.File, j map[string]any) error {
 		}
 	}()
 
+	// Save original contents for undo.
+	if err := journal.RecordRewrite(file.Name()); err != nil {
+		return err
+	}
+
 	// Seek file start.
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		return fmt.Errorf("failed to seek to beginning of file: %w", err)
@@ -10,6 +10,7 @@ import (
 	"metarr/internal/abstractions"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
+	"metarr/internal/journal"
 	"metarr/internal/models"
 	"metarr/internal/utils/prompt"
 	"os"
@@ -277,6 +278,11 @@ func (rw *NFOFileRW) refreshMetadataInternal(file *os.File) error {
 
 // writeMetadataToFile is a private metadata writing helper function.
 func (rw *NFOFileRW) writeMetadataToFile(file *os.File, content []byte) error {
+	// Save original contents for undo.
+	if err := journal.RecordRewrite(file.Name()); err != nil {
+		return err
+	}
+
 	if err := file.Truncate(0); err != nil {
 		return fmt.Errorf("truncate file: %w", err)
 	}
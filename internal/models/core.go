@@ -7,6 +7,7 @@ import (
 	"metarr/internal/abstractions"
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
+	"metarr/internal/events"
 	"os"
 	"sync"
 )
@@ -81,17 +82,57 @@ type FileData struct {
 	// File transformations.
 	FilenameOps *FilenameOps
 
+	// Cached FFprobe output for the video (see ffprobe.Probe).
+	Probe *ProbeData `json:"-" xml:"-"`
+
+	// External subtitle files to mux into the video.
+	Subtitles []SubtitleSidecar `json:"-" xml:"-"`
+
+	// Local thumbnail image saved beside the video (e.g. yt-dlp's 'Title.webp').
+	ThumbnailSidecar string `json:"-" xml:"-"`
+
+	// Thumbnail kept as '<video>-thumb.jpg' for Kodi, renamed and moved along with the video.
+	KodiThumbnail string `json:"-" xml:"-"`
+
+	// Set if any stage failed for the pair (its state is then not recorded).
+	Failed bool `json:"-" xml:"-"`
+
 	// Misc.
 	MetaAlreadyExists    bool `json:"-" xml:"-"`
 	ModelMOverwrite      bool
 	HasEmbeddedThumbnail bool
 }
 
+// ThumbnailSource returns the thumbnail to embed, preferring a local sidecar image over the metadata URL.
+func (fd *FileData) ThumbnailSource() string {
+	if fd.ThumbnailSidecar != "" {
+		return fd.ThumbnailSidecar
+	}
+	return fd.MWebData.Thumbnail
+}
+
 // SetFinalPaths sets the final video and metadata paths after all transformations are complete.
+//
+// Pairs which failed an earlier stage were already reported as failed, so don't get a 'file_finished' event.
 func (fd *FileData) SetFinalPaths(videoPath, metaPath string) {
 	fd.FinalVideoPath = videoPath
 	fd.FinalMetaPath = metaPath
 
+	if !fd.Failed {
+		events.Publish(events.Event{
+			Type:       events.FileFinished,
+			Video:      fd.OriginalVideoPath,
+			Meta:       fd.MetaFilePath,
+			FinalVideo: videoPath,
+			FinalMeta:  metaPath,
+		})
+	}
+
+	// Keep stdout clean for the dry-run plan.
+	if abstractions.GetBool(keys.DryRun) {
+		return
+	}
+
 	if _, err := fmt.Fprintf(os.Stdout, "final video path: %s\n", videoPath); err != nil {
 		logger.Pl.E("Failed to output final video path for %q due to error: %v", videoPath, err)
 	}
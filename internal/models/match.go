@@ -0,0 +1,30 @@
+package models
+
+// MatchReport lists the files in a batch which could not be paired.
+type MatchReport struct {
+	BatchID   int64            `json:"batch_id"`
+	Unmatched []UnpairedFile   `json:"unmatched_videos,omitempty"`
+	Orphans   []UnpairedFile   `json:"orphan_metafiles,omitempty"`
+	Ambiguous []AmbiguousMatch `json:"ambiguous,omitempty"`
+}
+
+// Empty returns true if every file in the batch was paired.
+func (r *MatchReport) Empty() bool {
+	return r == nil || (len(r.Unmatched) == 0 && len(r.Orphans) == 0 && len(r.Ambiguous) == 0)
+}
+
+// UnpairedFile is a video with no metafile, or a metafile with no video.
+type UnpairedFile struct {
+	Path          string  `json:"path"`
+	Closest       string  `json:"closest_candidate,omitempty"`
+	Similarity    float64 `json:"similarity,omitempty"`
+	QuarantinedTo string  `json:"quarantined_to,omitempty"`
+}
+
+// AmbiguousMatch is a video left unpaired because a strategy could not pick a single metafile for it.
+type AmbiguousMatch struct {
+	Video      string   `json:"video"`
+	Strategy   string   `json:"strategy"`
+	Reason     string   `json:"reason"`
+	Candidates []string `json:"candidates"`
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Stream types reported by FFprobe.
+const (
+	StreamVideo      = "video"
+	StreamAudio      = "audio"
+	StreamSubtitle   = "subtitle"
+	StreamData       = "data"
+	StreamAttachment = "attachment"
+)
+
+// ProbeData is the parsed output of a single 'ffprobe -show_format -show_streams' run.
+type ProbeData struct {
+	Streams []ProbeStream `json:"streams"`
+	Format  ProbeFormat   `json:"format"`
+}
+
+// ProbeFormat holds container-level FFprobe info.
+type ProbeFormat struct {
+	FormatName string    `json:"format_name"`
+	Duration   string    `json:"duration"`
+	BitRate    string    `json:"bit_rate"`
+	Size       string    `json:"size"`
+	Tags       ProbeTags `json:"tags"`
+}
+
+// ProbeStream holds per-stream FFprobe info.
+type ProbeStream struct {
+	Index       int              `json:"index"`
+	CodecType   string           `json:"codec_type"`
+	CodecName   string           `json:"codec_name"`
+	Profile     string           `json:"profile"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	PixFmt      string           `json:"pix_fmt"`
+	Channels    int              `json:"channels"`
+	SampleRate  string           `json:"sample_rate"`
+	Duration    string           `json:"duration"`
+	BitRate     string           `json:"bit_rate"`
+	Tags        ProbeTags        `json:"tags"`
+	Disposition ProbeDisposition `json:"disposition"`
+}
+
+// ProbeDisposition holds FFprobe stream disposition flags.
+type ProbeDisposition struct {
+	Default         int `json:"default"`
+	Forced          int `json:"forced"`
+	HearingImpaired int `json:"hearing_impaired"`
+	VisualImpaired  int `json:"visual_impaired"`
+	Comment         int `json:"comment"`
+	AttachedPic     int `json:"attached_pic"`
+}
+
+// ProbeTags is a map of metadata key-value pairs.
+//
+// Different container formats use different key names (e.g., "artist" vs "ARTIST" vs "WM/AlbumArtist").
+type ProbeTags map[string]string
+
+// Get grabs a tag value regardless of key casing (and WM/ prefixes).
+func (tags ProbeTags) Get(key string) string {
+	// Direct match.
+	if k, exists := tags[key]; exists {
+		return k
+	}
+
+	// Try variants.
+	if k, exists := tags[strings.ToLower(key)]; exists {
+		return k
+	}
+	if k, exists := tags[strings.ToUpper(key)]; exists {
+		return k
+	}
+	if k, exists := tags[strings.ToTitle(key)]; exists {
+		return k
+	}
+
+	// Special WM/ case attempts:
+	// If key contains "WM/", try the part after it with case variants.
+	_, after, found := strings.Cut(key, "WM/")
+	if found && after != "" {
+		// Try direct match without recursion.
+		if k, exists := tags[after]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToLower(after)]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToUpper(after)]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToTitle(after)]; exists {
+			return k
+		}
+	}
+	// Also try adding "WM/" prefix if not already present.
+	if !found { // WM/ was not in the original key.
+		wmKey := "WM/" + key
+		if k, exists := tags[wmKey]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToLower(wmKey)]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToUpper(wmKey)]; exists {
+			return k
+		}
+		if k, exists := tags[strings.ToTitle(wmKey)]; exists {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// IsAttachedPic returns true if the stream is embedded cover art.
+func (s *ProbeStream) IsAttachedPic() bool {
+	return s.CodecType == StreamVideo && s.Disposition.AttachedPic == 1
+}
+
+// Language returns the stream's language tag, if any.
+func (s *ProbeStream) Language() string {
+	return s.Tags.Get("language")
+}
+
+// Title returns the stream's title tag, if any.
+func (s *ProbeStream) Title() string {
+	return s.Tags.Get("title")
+}
+
+// HasDisposition returns true if the named disposition flag (e.g. "forced") is set on the stream.
+func (s *ProbeStream) HasDisposition(name string) bool {
+	switch name {
+	case "default":
+		return s.Disposition.Default == 1
+	case "forced":
+		return s.Disposition.Forced == 1
+	case "hearing_impaired":
+		return s.Disposition.HearingImpaired == 1
+	case "visual_impaired":
+		return s.Disposition.VisualImpaired == 1
+	case "comment":
+		return s.Disposition.Comment == 1
+	case "attached_pic":
+		return s.Disposition.AttachedPic == 1
+	}
+	return false
+}
+
+// StreamsOfType returns the streams of a type in file order, excluding attached pictures.
+func (p *ProbeData) StreamsOfType(codecType string) []ProbeStream {
+	out := make([]ProbeStream, 0, len(p.Streams))
+	for _, s := range p.Streams {
+		if s.CodecType == codecType && !s.IsAttachedPic() {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// FirstCodec returns the codec of the first stream of a type (attached pictures excluded).
+func (p *ProbeData) FirstCodec(codecType string) string {
+	for _, s := range p.Streams {
+		if s.CodecType == codecType && !s.IsAttachedPic() {
+			return s.CodecName
+		}
+	}
+	return ""
+}
+
+// HasAttachedPic returns true if the file has embedded cover art.
+func (p *ProbeData) HasAttachedPic() bool {
+	for _, s := range p.Streams {
+		if s.IsAttachedPic() {
+			return true
+		}
+	}
+	return false
+}
+
+// DurationSeconds returns the container duration (0 if unknown).
+func (p *ProbeData) DurationSeconds() float64 {
+	d, err := strconv.ParseFloat(p.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// BitRate returns the container bitrate in bits per second (0 if unknown).
+func (p *ProbeData) BitRate() int64 {
+	b, err := strconv.ParseInt(p.Format.BitRate, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return b
+}
@@ -0,0 +1,8 @@
+package models
+
+// SubtitleSidecar is an external subtitle file found beside a video (e.g. yt-dlp's 'Title.en.vtt').
+type SubtitleSidecar struct {
+	Path     string
+	Language string // ISO 639-2 code ("und" if unknown).
+	Codec    string // FFmpeg codec name of the file format (e.g. "webvtt").
+}
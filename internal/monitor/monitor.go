@@ -0,0 +1,155 @@
+// Package monitor serves live logs and worker status over local HTTP, for watching headless runs.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/domain/logger"
+	"metarr/internal/progress"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// tailInterval is how often the log stream checks for new lines.
+const tailInterval = 500 * time.Millisecond
+
+//go:embed index.html
+var indexHTML []byte
+
+// statusResponse is the body of '/status'.
+type statusResponse struct {
+	Started time.Time               `json:"started"`
+	Uptime  float64                 `json:"uptime_seconds"`
+	Workers []progress.WorkerStatus `json:"workers"`
+	FFmpeg  progress.Summary        `json:"ffmpeg"`
+}
+
+// monitor serves the endpoints.
+type monitor struct {
+	ctx     context.Context
+	started time.Time
+}
+
+// Start listens on addr and serves until the context is cancelled.
+func Start(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start status server: %w", err)
+	}
+
+	m := &monitor{ctx: ctx, started: time.Now()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", m.index)
+	mux.HandleFunc("GET /logs", m.logs)
+	mux.HandleFunc("GET /logs/stream", m.streamLogs)
+	mux.HandleFunc("GET /status", m.status)
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Pl.E("Status server failed: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Pl.I("Status server listening on http://%s", ln.Addr())
+	return nil
+}
+
+// index serves a page showing worker status and a live log tail.
+func (m *monitor) index(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(indexHTML)
+}
+
+// logs returns the in-memory log ring buffer as JSON lines, oldest first (the last 'n' lines if set).
+func (m *monitor) logs(w http.ResponseWriter, r *http.Request) {
+	lines := logger.Pl.GetRecentLogs()
+	if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && n >= 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		_, _ = w.Write(bytes.TrimRight(line, "\n"))
+		_, _ = w.Write([]byte{'\n'})
+	}
+}
+
+// streamLogs sends new log lines as Server-Sent Events.
+func (m *monitor) streamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	pos, wrapped := logger.Pl.GetBufferPosition(), logger.Pl.IsBufferFull()
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Advance by the lines returned, so lines logged in between aren't skipped.
+		lines := logger.Pl.GetLogsSincePosition(pos, wrapped)
+		if size := len(logger.Pl.LogBuffer); size > 0 {
+			wrapped = wrapped || pos+len(lines) >= size
+			pos = (pos + len(lines)) % size
+		}
+		for _, line := range lines {
+			if len(line) == 0 {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: log\ndata: %s\n\n", bytes.TrimRight(line, "\n")); err != nil {
+				return
+			}
+		}
+		if len(lines) > 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+// status returns what each worker is doing, with live FFmpeg progress.
+func (m *monitor) status(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.MarshalIndent(statusResponse{
+		Started: m.started,
+		Uptime:  time.Since(m.started).Seconds(),
+		Workers: progress.Workers(),
+		FFmpeg:  progress.Aggregate(),
+	}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(data, '\n'))
+}
@@ -0,0 +1,293 @@
+// Package plan records the changes Metarr would make during a dry run, without touching the filesystem.
+package plan
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// Operation types.
+const (
+	OpRename  = "rename"
+	OpMove    = "move"
+	OpDelete  = "delete"
+	OpBackup  = "backup"
+	OpReplace = "replace"
+	OpMkdir   = "mkdir"
+	OpConvert = "convert"
+	OpCreate  = "create"
+)
+
+// Field change types.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// FieldDiff is a single metadata field change.
+type FieldDiff struct {
+	Field  string `json:"field"`
+	Change string `json:"change"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// Operation is a single planned filesystem change.
+type Operation struct {
+	Op  string `json:"op"`
+	Src string `json:"src"`
+	Dst string `json:"dst,omitempty"`
+}
+
+// FilePlan holds every planned change for a video/metadata pair.
+type FilePlan struct {
+	Video      string      `json:"video,omitempty"`
+	Metafile   string      `json:"metafile,omitempty"`
+	MetaDiffs  []FieldDiff `json:"meta_diffs,omitempty"`
+	FFmpegArgv []string    `json:"ffmpeg_argv,omitempty"`
+	Operations []Operation `json:"operations,omitempty"`
+}
+
+var (
+	mu          sync.Mutex
+	plans       = make(map[string]*FilePlan)
+	claimed     = make(map[string]bool)
+	scratchDirs []string // Removed once the plan is written.
+)
+
+// Enabled returns true if the program is running in dry-run mode.
+func Enabled() bool {
+	return abstractions.GetBool(keys.DryRun)
+}
+
+// Reset discards the plan, e.g. between jobs in server mode.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	plans = make(map[string]*FilePlan)
+	claimed = make(map[string]bool)
+	removeScratchDirs()
+}
+
+// get returns (creating if needed) the plan for a file pair. Must be called under lock.
+func get(fd *models.FileData) *FilePlan {
+	key := fd.OriginalVideoPath
+	if key == "" {
+		key = fd.MetaFilePath
+	}
+	p, exists := plans[key]
+	if !exists {
+		p = &FilePlan{
+			Video:    fd.OriginalVideoPath,
+			Metafile: fd.MetaFilePath,
+		}
+		plans[key] = p
+	}
+	return p
+}
+
+// AddOperation records a planned filesystem operation.
+func AddOperation(fd *models.FileData, op, src, dst string) {
+	if fd == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	p := get(fd)
+	p.Operations = append(p.Operations, Operation{
+		Op:  op,
+		Src: src,
+		Dst: dst,
+	})
+	logger.Pl.I("[dry-run] %s: %q → %q", op, src, dst)
+}
+
+// SetFFmpegArgv records the FFmpeg command which would be run.
+func SetFFmpegArgv(fd *models.FileData, args []string) {
+	if fd == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	get(fd).FFmpegArgv = append([]string{"ffmpeg"}, args...)
+}
+
+// ClaimPath reserves a destination path so planned renames don't collide with each other.
+//
+// Returns false if the path was already claimed. Always true outside of dry runs.
+func ClaimPath(path string) bool {
+	if !Enabled() {
+		return true
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	path = filepath.Clean(path)
+	if claimed[path] {
+		return false
+	}
+	claimed[path] = true
+	return true
+}
+
+// ScratchCopy copies a metafile into a temporary directory so edits can be evaluated without touching the original.
+//
+// The returned cleanup function removes the scratch directory.
+func ScratchCopy(path string) (scratchPath string, cleanup func(), err error) {
+	dir, err := os.MkdirTemp("", "metarr-dryrun-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Pl.E("Failed to remove scratch directory %q: %v", dir, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	scratchPath = filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(scratchPath, data, 0o600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write scratch copy of %q: %w", path, err)
+	}
+	return scratchPath, cleanup, nil
+}
+
+// RecordMetaDiff compares the original metafile to its edited scratch copy and records the field changes.
+func RecordMetaDiff(fd *models.FileData, origPath, editedPath string) error {
+	if fd == nil {
+		return nil
+	}
+	before, err := decodeFields(origPath, fd.MetaFileType)
+	if err != nil {
+		return err
+	}
+	after, err := decodeFields(editedPath, fd.MetaFileType)
+	if err != nil {
+		return err
+	}
+	diffs := diffFields(before, after)
+
+	mu.Lock()
+	defer mu.Unlock()
+	get(fd).MetaDiffs = diffs
+	return nil
+}
+
+// ScratchDir creates a temporary directory for files needed for the rest of the dry run, removed by Write.
+func ScratchDir() (string, error) {
+	dir, err := os.MkdirTemp("", "metarr-dryrun-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	scratchDirs = append(scratchDirs, dir)
+	return dir, nil
+}
+
+// removeScratchDirs removes the directories made by ScratchDir. Must be called under lock.
+func removeScratchDirs() {
+	for _, dir := range scratchDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Pl.E("Failed to remove scratch directory %q: %v", dir, err)
+		}
+	}
+	scratchDirs = nil
+}
+
+// Write outputs all file plans as a JSON array, sorted by path, then removes the run's scratch directories.
+func Write(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+	defer removeScratchDirs()
+
+	out := make([]*FilePlan, 0, len(plans))
+	for _, p := range plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Video != out[j].Video {
+			return out[i].Video < out[j].Video
+		}
+		return out[i].Metafile < out[j].Metafile
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to encode dry-run plan: %w", err)
+	}
+	return nil
+}
+
+// decodeFields decodes a metafile into a generic field map.
+func decodeFields(path, metaType string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+
+	fields := make(map[string]any)
+	switch strings.ToLower(metaType) {
+	case sharedconsts.MExtNFO:
+		// Round trip through JSON to get a comparable map.
+		var nfo models.NFOData
+		if err := xml.Unmarshal(data, &nfo); err != nil {
+			return nil, fmt.Errorf("failed to decode NFO %q: %w", path, err)
+		}
+		b, err := json.Marshal(nfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal NFO %q: %w", path, err)
+		}
+		data = b
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %w", path, err)
+	}
+	return fields, nil
+}
+
+// diffFields returns the top-level field differences between two maps, sorted by field name.
+func diffFields(before, after map[string]any) []FieldDiff {
+	var diffs []FieldDiff
+	for k, oldVal := range before {
+		newVal, exists := after[k]
+		switch {
+		case !exists:
+			diffs = append(diffs, FieldDiff{Field: k, Change: changeRemoved, Old: oldVal})
+		case !reflect.DeepEqual(oldVal, newVal):
+			diffs = append(diffs, FieldDiff{Field: k, Change: changeChanged, Old: oldVal, New: newVal})
+		}
+	}
+	for k, newVal := range after {
+		if _, exists := before[k]; !exists {
+			diffs = append(diffs, FieldDiff{Field: k, Change: changeAdded, New: newVal})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
@@ -8,7 +8,10 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
+	"metarr/internal/events"
+	"metarr/internal/file"
 	"metarr/internal/models"
+	"metarr/internal/report"
 	"os"
 	"path/filepath"
 	"sync"
@@ -24,6 +27,8 @@ type batch struct {
 	IsDirs     bool
 	SkipVideos bool
 	bp         *batchProcessor
+	run        *run           // The ProcessBatches call the batch belongs to.
+	pending    sync.WaitGroup // Files still queued or processing in the pipeline.
 }
 
 type batchProcessor struct {
@@ -73,7 +78,9 @@ var batchPool = &sync.Pool{
 }
 
 // ProcessBatches begins processing the batch.
-func ProcessBatches(core *models.Core) ([]*models.FileData, error) {
+//
+// Files are processed on 'pipe', or on a pipeline of their own if it's nil.
+func ProcessBatches(core *models.Core, pipe *Pipeline) ([]*models.FileData, error) {
 	batches, err := initializeBatchConfigs()
 	if err != nil {
 		return nil, err
@@ -84,12 +91,16 @@ func ProcessBatches(core *models.Core) ([]*models.FileData, error) {
 	}
 	job := 1
 
-	// Collect all processed files from all batches.
-	allProcessedFiles := []*models.FileData{} // Do not assign length.
-
 	// Begin iteration...
 	skipVideos := abstractions.GetBool(keys.SkipVideos)
 	failCount := 0
+
+	// All batches feed one pipeline of metadata and video workers.
+	if pipe == nil {
+		pipe = StartPipeline(abstractions.GetInt(keys.MetaConcurrency), abstractions.GetInt(keys.Concurrency))
+		defer pipe.Stop()
+	}
+	r := &run{ctx: core.Ctx}
 	for _, b := range batches {
 		var (
 			openVideo *os.File
@@ -98,6 +109,7 @@ func ProcessBatches(core *models.Core) ([]*models.FileData, error) {
 		)
 
 		batch := convertCfgToBatch(b)
+		batch.run = r
 		logger.Pl.I("Starting batch job %d. Skip videos on this run? %v", job, batch.SkipVideos)
 
 		if batch.SkipVideos {
@@ -107,6 +119,7 @@ func ProcessBatches(core *models.Core) ([]*models.FileData, error) {
 		// Open video file if necessary
 		if !skipVideos {
 			if openVideo, err = os.Open(batch.Video); err != nil {
+				vars.AddError(vars.ErrPairing, batch.Video, err)
 				logger.Pl.E("Failed to open %s", batch.Video)
 				failCount++
 				continue
@@ -115,53 +128,44 @@ func ProcessBatches(core *models.Core) ([]*models.FileData, error) {
 
 		// Open JSON file
 		if openJSON, err = os.Open(batch.JSON); err != nil {
+			vars.AddError(vars.ErrPairing, batch.JSON, err)
 			logger.Pl.E("Failed to open %s", batch.JSON)
 			// Close accompanying video...
 			if openVideo != nil {
 				if err := openVideo.Close(); err != nil {
-					return allProcessedFiles, fmt.Errorf("failed to close failed video %q after JSON failure: %w", openVideo.Name(), err)
+					return r.wait(), fmt.Errorf("failed to close failed video %q after JSON failure: %w", openVideo.Name(), err)
 				}
 			}
 			failCount++
 			continue
 		}
 
-		// Initiate batch process
-		processedFiles, err := processBatch(batch, core, openVideo, openJSON)
-		if err != nil {
-			logger.Pl.E("Batch with ID %d failed: %v", batch.bp.batchID, err)
-			failCount++
-			continue
-		}
-
-		// Append this batch's files to the overall collection
-		allProcessedFiles = append(allProcessedFiles, processedFiles...)
-
-		// Completion message
-		fileOrDirMsg := "Directory"
-		if !batch.IsDirs {
-			fileOrDirMsg = "File"
-		}
+		// Initiate batch process (its files finish in the background)
+		err = processBatch(batch, core, pipe, openVideo, openJSON)
 
-		var videoDoneMsg string
-		if !batch.SkipVideos {
-			videoDoneMsg = fmt.Sprintf("Input Video %s: %q\n", fileOrDirMsg, batch.Video)
-		}
-
-		logger.Pl.I("Finished tasks for:\n\n%sInput JSON %s: %q\n", videoDoneMsg, fileOrDirMsg, batch.JSON)
-
-		// Close files explicitly at the end of each iteration
+		// Close files explicitly at the end of each iteration, they're only needed for pairing
 		if openVideo != nil {
 			if err := openVideo.Close(); err != nil {
-				logger.Pl.E("Failed to close video file %q after successful iteration: %v", openVideo.Name(), err)
+				logger.Pl.E("Failed to close video file %q: %v", openVideo.Name(), err)
 			}
 		}
 		if err := openJSON.Close(); err != nil {
-			logger.Pl.E("Failed to close JSON file %q after successful iteration: %v", openJSON.Name(), err)
+			logger.Pl.E("Failed to close JSON file %q: %v", openJSON.Name(), err)
+		}
+
+		if err != nil {
+			vars.AddError(vars.ErrPairing, batch.JSON, err)
+			logger.Pl.E("Batch with ID %d failed: %v", batch.ID, err)
+			events.Publish(events.Event{Type: events.Error, Detail: "batch", Error: err.Error()})
+			failCount++
+			continue
 		}
 		job++
 	}
 
+	// Wait for every batch's files.
+	allProcessedFiles := r.wait()
+
 	if failCount == len(batches) {
 		return nil, fmt.Errorf("all batches failed")
 	}
@@ -318,27 +322,46 @@ func convertCfgToBatch(config models.BatchConfig) *batch {
 }
 
 // processBatch is the entrypoint for batch processing.
-func processBatch(batch *batch, core *models.Core, openVideo, openMeta *os.File) (fdArray []*models.FileData, err error) {
+//
+// The batch's files are queued in the pipeline, and the batch is finished once they're done.
+func processBatch(batch *batch, core *models.Core, pipe *Pipeline, openVideo, openMeta *os.File) (err error) {
 	if batch == nil {
-		return nil, errors.New("batch entered null")
+		return errors.New("batch entered null")
 	}
 
 	if batch.bp, err = getNewBatchProcessor(batch.ID); err != nil {
-		return nil, err
+		return err
 	}
-	defer batch.bp.release()
 
-	if fdArray, err = processFiles(batch, core, openVideo, openMeta); err != nil {
-		return fdArray, err
+	if err = queueFiles(batch, core, pipe, openVideo, openMeta); err != nil {
+		batch.bp.release()
+		return err
 	}
+	batch.run.onBatchDone(batch, batch.finish)
+	return nil
+}
 
-	errArray := vars.GetErrorArray()
-	if len(errArray) == 0 {
+// finish logs the batch's results and releases its processor.
+func (b *batch) finish() {
+	defer b.bp.release()
+
+	if b.bp.logFailedVideos() == 0 {
 		fmt.Fprintf(os.Stderr, "\n")
-		logger.Pl.S("Successfully processed all files in directory %q with no errors.\n", filepath.Dir(batch.bp.filepaths.metaFile))
-		return fdArray, nil
+		logger.Pl.S("Successfully processed all files in directory %q with no errors.\n", filepath.Dir(b.bp.filepaths.metaFile))
+	}
+
+	// Completion message
+	fileOrDirMsg := "Directory"
+	if !b.IsDirs {
+		fileOrDirMsg = "File"
 	}
-	return fdArray, nil
+
+	var videoDoneMsg string
+	if !b.SkipVideos {
+		videoDoneMsg = fmt.Sprintf("Input Video %s: %q\n", fileOrDirMsg, b.Video)
+	}
+
+	logger.Pl.I("Finished tasks for:\n\n%sInput JSON %s: %q\n", videoDoneMsg, fileOrDirMsg, b.JSON)
 }
 
 // getBatchProcessor returns the singleton batchProcessor instance.
@@ -356,12 +379,22 @@ func (bp *batchProcessor) addFailure(f failedVideo) {
 	bp.failures.mu.Lock()
 	bp.failures.items = append(bp.failures.items, f)
 	bp.failures.mu.Unlock()
+
+	report.AddFailure(report.Failure{
+		Batch: bp.batchID,
+		File:  f.filename,
+		Stage: f.stage,
+		Error: f.err,
+	})
 }
 
-// logFailedVideos logs videos which failed during this batch.
-func (bp *batchProcessor) logFailedVideos() {
+// logFailedVideos logs videos which failed during this batch, returning how many.
+func (bp *batchProcessor) logFailedVideos() int {
+	bp.failures.mu.Lock()
+	defer bp.failures.mu.Unlock()
+
 	if len(bp.failures.items) == 0 {
-		return
+		return 0
 	}
 
 	for i, failed := range bp.failures.items {
@@ -373,6 +406,7 @@ func (bp *batchProcessor) logFailedVideos() {
 		logger.Pl.P("Error: %v", failed.err)
 	}
 	fmt.Fprintf(os.Stderr, "\n")
+	return len(bp.failures.items)
 }
 
 // syncMapToRegularMap converts the sync map back to a regular map for further processing.
@@ -422,3 +456,49 @@ func (bp *batchProcessor) release() {
 	bp.batchID = 0
 	batchPool.Put(bp)
 }
+
+// RecoverTempFiles handles leftover FFmpeg temp files in the configured directory batches.
+func RecoverTempFiles() error {
+	batches, err := initializeBatchConfigs()
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		if !b.IsDirs || b.Video == "" {
+			continue
+		}
+		if err := file.RecoverTempFiles(b.Video); err != nil {
+			logger.Pl.E("Failed to recover temp files in %q: %v", b.Video, err)
+		}
+	}
+	return nil
+}
+
+// WatchDirs returns the directories holding the configured batches (the parent directory for file batches).
+func WatchDirs() ([]string, error) {
+	batches, err := initializeBatchConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(batches)*2)
+	dirs := make([]string, 0, len(batches)*2)
+	for _, b := range batches {
+		for _, p := range []string{b.Video, b.JSON} {
+			if p == "" {
+				continue
+			}
+			if !b.IsDirs {
+				p = filepath.Dir(p)
+			}
+			if abs, err := filepath.Abs(p); err == nil {
+				p = abs
+			}
+			if !seen[p] {
+				seen[p] = true
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	return dirs, nil
+}
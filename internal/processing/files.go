@@ -7,14 +7,18 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
+	"metarr/internal/events"
 	"metarr/internal/ffmpeg"
 	"metarr/internal/file"
 	"metarr/internal/models"
+	"metarr/internal/progress"
+	"metarr/internal/report"
+	"metarr/internal/state"
 	"os"
 	"path/filepath"
-	"runtime/debug"
-	"sync"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
 )
@@ -26,18 +30,20 @@ const (
 
 type failedVideo struct {
 	filename string
+	stage    string
 	err      string
 }
 
 type workItem struct {
+	batch        *batch
 	filename     string
 	fileData     *models.FileData
 	metaFilename string
 	skipVids     bool
 }
 
-// processFiles is the main program function to process folder entries.
-func processFiles(batch *batch, core *models.Core, openVideo, openMeta *os.File) ([]*models.FileData, error) {
+// queueFiles pairs a batch's files, then queues them in the pipeline.
+func queueFiles(batch *batch, core *models.Core, pipe *Pipeline, openVideo, openMeta *os.File) error {
 	var skipVideos bool
 	if abstractions.IsSet(keys.SkipVideos) {
 		skipVideos = abstractions.GetBool(keys.SkipVideos)
@@ -46,131 +52,68 @@ func processFiles(batch *batch, core *models.Core, openVideo, openMeta *os.File)
 	}
 
 	// Match and video file maps, and meta file count.
-	if err := getFiles(batch, openMeta, openVideo, skipVideos); err != nil {
-		return nil, err
+	progress.SetWorker(progress.BatchWorker, batch.ID, progress.StagePairing, "")
+	defer progress.RemoveWorker(progress.BatchWorker)
+	if err := getFiles(core.Ctx, batch, openMeta, openVideo, skipVideos); err != nil {
+		return err
 	}
 
 	logger.Pl.I("Found %d file(s) to process", batch.bp.counts.totalMatched)
 	logger.Pl.D(3, "Matched metafiles: %d", batch.bp.counts.totalMatched)
 
-	var (
-		muProcessed sync.Mutex
-		muFailed    sync.Mutex
-	)
-
-	ctx := core.Ctx
-	wg := core.Wg
-
-	processMetadataFiles(ctx, batch.bp, batch.bp.syncMapToRegularMap(&batch.bp.files.matched), &muFailed)
-	setupCleanup(ctx, wg, batch, &muFailed)
-
-	matchedCount := int(batch.bp.counts.totalMatched)
-	processedModels := make([]*models.FileData, 0, matchedCount)
-	numWorkers := max(abstractions.GetInt(keys.Concurrency), 1)
-
-	jobs := make(chan workItem, min(matchedCount, numWorkers*2))
-	results := make(chan *models.FileData, min(matchedCount, numWorkers*2))
-
-	// Start workers.
-	for worker := 1; worker <= numWorkers; worker++ {
-		wg.Add(1)
-		go workerVideoProcess(ctx, wg, batch, worker, jobs, results)
-	}
+	progress.RemoveWorker(progress.BatchWorker)
 
-	// Collector routine to collect results from the results channel.
-	var collectorWg sync.WaitGroup
-	collectorWg.Add(1)
-	go func() {
-		defer collectorWg.Done()
-
-		for result := range results {
-			if result != nil {
-				muProcessed.Lock()
-				processedModels = append(processedModels, result)
-				muProcessed.Unlock()
-			}
-		}
-	}()
-
-	// Send jobs to workers.
+	// Send jobs to the shared workers.
 	for name, data := range batch.bp.syncMapToRegularMap(&batch.bp.files.matched) {
-		jobs <- workItem{
+		pipe.submit(workItem{
+			batch:        batch,
 			filename:     name,
 			fileData:     data,
 			metaFilename: batch.bp.filepaths.metaFile,
 			skipVids:     skipVideos,
-		}
-	}
-	close(jobs)
-	wg.Wait()
-
-	close(results)
-	collectorWg.Wait()
-
-	// Get errors.
-	errArray := vars.GetErrorArray()
-	if errArray != nil {
-		batch.bp.logFailedVideos()
+		})
 	}
-	return processedModels, nil
+	return nil
 }
 
-// workerVideoProcess performs the video processing operation for a worker.
-func workerVideoProcess(ctx context.Context, wg *sync.WaitGroup, batch *batch, id int, jobs <-chan workItem, results chan<- *models.FileData) {
-	defer wg.Done()
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Pl.E("Worker %d panicked: %v\n%s", id, r, debug.Stack())
-		}
-	}()
-
-	// Execute video jobs.
-	for job := range jobs {
-		skipVideos := job.skipVids
-		filename := job.filename
-
-		select {
-		case <-ctx.Done():
-			logger.Pl.I("Worker %d stopping due to context cancellation", id)
-			return
-		default:
-			logger.Pl.D(1, "Worker %d processing file: %s", id, filename)
-
-			executed, err := executeFile(ctx, batch.bp, skipVideos, filename, job.fileData)
-			if err != nil {
-				logger.Pl.E("Worker %d error executing file %q: %v", id, filename, err)
-				continue
-			}
-			results <- executed
-		}
+// processMetadata processes a pair's metafile, such as .json, .nfo, and so on.
+//
+// Failures are recorded against the pair, which still goes on to the video stage.
+func processMetadata(ctx context.Context, bp *batchProcessor, filename string, fd *models.FileData) {
+	report.Add(fd, bp.batchID)
+
+	var err error
+	start := time.Now()
+	switch fd.MetaFileType {
+	case sharedconsts.MExtJSON:
+		logger.Pl.D(3, "File: %s: Meta file type in model as %v", fd.MetaFilePath, fd.MetaFileType)
+		err = processJSONFile(ctx, fd)
+	case sharedconsts.MExtNFO:
+		logger.Pl.D(3, "File: %s: Meta file type in model as %v", fd.MetaFilePath, fd.MetaFileType)
+		err = processNFOFiles(ctx, fd)
 	}
-}
-
-// processMetadataFiles processes metafiles such as .json, .nfo, and so on.
-func processMetadataFiles(ctx context.Context, bp *batchProcessor, matchedFiles map[string]*models.FileData, muFailed *sync.Mutex) {
-	for _, fd := range matchedFiles {
-		var err error
-		switch fd.MetaFileType {
-		case sharedconsts.MExtJSON:
-			logger.Pl.D(3, "File: %s: Meta file type in model as %v", fd.MetaFilePath, fd.MetaFileType)
-			err = processJSONFile(ctx, fd)
-		case sharedconsts.MExtNFO:
-			logger.Pl.D(3, "File: %s: Meta file type in model as %v", fd.MetaFilePath, fd.MetaFileType)
-			err = processNFOFiles(ctx, fd)
-		}
-		if err != nil {
-			vars.AddToErrorArray(err)
-			logger.Pl.E("Failed processing metadata for file %q: %v", fd.OriginalVideoPath, err)
-
-			muFailed.Lock()
-			bp.logFailedVideos()
-			muFailed.Unlock()
-		}
+	report.AddStage(fd, report.StageMeta, start, err)
+	if err != nil {
+		fd.Failed = true
+		vars.AddError(vars.ErrMetadata, fd.MetaFilePath, err)
+		logger.Pl.E("Failed processing metadata for file %q: %v", fd.OriginalVideoPath, err)
+		events.Publish(events.Event{
+			Type:   events.FileFailed,
+			Video:  fd.OriginalVideoPath,
+			Meta:   fd.MetaFilePath,
+			Detail: "metadata",
+			Error:  err.Error(),
+		})
+		bp.addFailure(failedVideo{
+			filename: filename,
+			stage:    report.StageMeta,
+			err:      err.Error(),
+		})
 	}
 }
 
 // getFiles returns a map of matched video/metadata files.
-func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err error) {
+func getFiles(ctx context.Context, batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err error) {
 	videoMap := make(map[string]*models.FileData)
 	metaMap := make(map[string]*models.FileData)
 
@@ -180,6 +123,7 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 		if err != nil {
 			batch.bp.addFailure(failedVideo{
 				filename: openMeta.Name(),
+				stage:    report.StageScan,
 				err:      err.Error(),
 			})
 			return fmt.Errorf("failed to retrieve metadata files in %q: %w", openMeta.Name(), err)
@@ -190,6 +134,7 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 			if err != nil {
 				batch.bp.addFailure(failedVideo{
 					filename: openVideo.Name(),
+					stage:    report.StageScan,
 					err:      err.Error(),
 				})
 				return fmt.Errorf("failed to retrieve video files in %q: %w", openVideo.Name(), err)
@@ -201,6 +146,7 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 		if err != nil {
 			batch.bp.addFailure(failedVideo{
 				filename: openMeta.Name(),
+				stage:    report.StageScan,
 				err:      err.Error(),
 			})
 			return fmt.Errorf("failed to retrieve metadata file %q: %w", openMeta.Name(), err)
@@ -211,6 +157,7 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 			if err != nil {
 				batch.bp.addFailure(failedVideo{
 					filename: openVideo.Name(),
+					stage:    report.StageScan,
 					err:      err.Error(),
 				})
 				return fmt.Errorf("failed to retrieve video file %q: %w", openVideo.Name(), err)
@@ -221,7 +168,9 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 	// Match video and metadata files.
 	var matchedFiles map[string]*models.FileData // Do not assign length (just a placeholder var, will show unused otherwise).
 	if !skipVideos {
-		matchedFiles, err = file.MatchVideoWithMetadata(videoMap, metaMap, batch.ID)
+		var report *models.MatchReport
+		matchedFiles, report, err = file.MatchVideoWithMetadata(ctx, videoMap, metaMap, batch.ID)
+		handleMatchReport(batch, report, openMeta)
 		if err != nil {
 			return fmt.Errorf("error matching videos with metadata: %w", err)
 		}
@@ -250,6 +199,20 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 		openVideoFilename = openVideo.Name()
 	}
 
+	// Skip pairs unchanged since the last successful run, or since they failed in watch mode.
+	for k, v := range matchedFiles {
+		switch {
+		case state.Unchanged(v):
+			logger.Pl.I("Skipping %q, unchanged since last run", k)
+		case state.FailedUnchanged(v):
+			logger.Pl.I("Skipping %q, unchanged since it failed", k)
+		default:
+			continue
+		}
+		delete(matchedFiles, k)
+		delete(videoMap, k)
+	}
+
 	for k, v := range matchedFiles {
 		batch.bp.files.matched.Store(k, v)
 	}
@@ -270,6 +233,52 @@ func getFiles(batch *batch, openMeta, openVideo *os.File, skipVideos bool) (err
 	return nil
 }
 
+// handleMatchReport quarantines orphan metafiles if requested, then prints and saves the batch's unpaired files.
+func handleMatchReport(batch *batch, report *models.MatchReport, openMeta *os.File) {
+	if report.Empty() {
+		return
+	}
+
+	if q := abstractions.GetString(keys.QuarantineDir); q != "" && openMeta != nil {
+		metaRoot := openMeta.Name()
+		if !batch.IsDirs {
+			metaRoot = filepath.Dir(metaRoot)
+		}
+		if err := file.QuarantineOrphans(report, metaRoot, q); err != nil {
+			logger.Pl.E("Failed to quarantine orphan metafiles: %v", err)
+		}
+	}
+
+	for _, a := range report.Ambiguous {
+		logger.Pl.W("Ambiguous pairing for video %q (%s: %s): %v", a.Video, a.Strategy, a.Reason, a.Candidates)
+	}
+	for _, u := range report.Unmatched {
+		logger.Pl.W("No metafile found for video %q%s", u.Path, closestNote(u))
+	}
+	for _, o := range report.Orphans {
+		logger.Pl.W("No video found for metafile %q%s", o.Path, closestNote(o))
+	}
+	logger.Pl.W("Batch %d: %d ambiguous video(s), %d unmatched video(s), %d orphan metafile(s)", batch.ID, len(report.Ambiguous), len(report.Unmatched), len(report.Orphans))
+
+	if path, err := file.WritePairingReport(report); err != nil {
+		logger.Pl.E("Failed to save pairing report: %v", err)
+	} else {
+		logger.Pl.I("Saved pairing report to %q", path)
+	}
+}
+
+// closestNote describes the nearest candidate of an unpaired file for logging.
+func closestNote(u models.UnpairedFile) string {
+	var b strings.Builder
+	if u.Closest != "" {
+		fmt.Fprintf(&b, " (closest: %q, %.0f%% similar)", u.Closest, u.Similarity*100)
+	}
+	if u.QuarantinedTo != "" {
+		fmt.Fprintf(&b, ", quarantined to %q", u.QuarantinedTo)
+	}
+	return b.String()
+}
+
 // executeFile handles processing for both video and metadata files.
 func executeFile(ctx context.Context, bp *batchProcessor, skipVideos bool, filename string, fd *models.FileData) (*models.FileData, error) {
 	// Check for context cancellation.
@@ -279,6 +288,12 @@ func executeFile(ctx context.Context, bp *batchProcessor, skipVideos bool, filen
 	default:
 	}
 
+	events.Publish(events.Event{
+		Type:  events.FileStarted,
+		Video: fd.OriginalVideoPath,
+		Meta:  fd.MetaFilePath,
+	})
+
 	// Print progress for metadata.
 	currentMeta := atomic.AddInt32(&bp.counts.processedMeta, 1)
 	totalMeta := atomic.LoadInt32(&bp.counts.totalMeta)
@@ -294,22 +309,30 @@ func executeFile(ctx context.Context, bp *batchProcessor, skipVideos bool, filen
 		logger.Pl.I("Processing file: %s", filename)
 		if !skipVideos {
 			if err := ffmpeg.ExecuteVideo(ctx, fd); err != nil {
+				fd.Failed = true
 
 				errMsg := fmt.Errorf("failed to process video '%v': %w", filename, err)
-				vars.AddToErrorArray(errMsg)
+				vars.AddError(vars.ErrFFmpeg, fd.OriginalVideoPath, errMsg)
+				report.AddError(fd, report.StageFFmpeg, errMsg)
 				logger.Pl.E("Failed to execute video %q: %v", fd.OriginalVideoPath, err)
+				events.Publish(events.Event{
+					Type:  events.FileFailed,
+					Video: fd.OriginalVideoPath,
+					Meta:  fd.MetaFilePath,
+					Error: err.Error(),
+				})
 
 				bp.addFailure(failedVideo{
 					filename: filename,
+					stage:    report.StageFFmpeg,
 					err:      errMsg.Error(),
 				})
 				return nil, errMsg
 			}
-			fmt.Fprintf(os.Stderr, "\n")
 			logger.Pl.S("Successfully processed video %s", filename)
 		}
 	} else {
-		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(progress.Stderr, "\n")
 		logger.Pl.S("Successfully processed metadata for %s", filename)
 	}
 
@@ -320,23 +343,3 @@ func executeFile(ctx context.Context, bp *batchProcessor, skipVideos bool, filen
 
 	return fd, nil
 }
-
-// setupCleanup watches the context and safely cleans up batch resources on cancellation.
-func setupCleanup(ctx context.Context, wg *sync.WaitGroup, batch *batch, muFailed *sync.Mutex) {
-	go func() {
-		// Wait for context finish or cancellation.
-		<-ctx.Done()
-		logger.Pl.D(2, "Context ended, performing cleanup for batch %d", batch.bp.batchID)
-
-		// Wait for workers to finish.
-		wg.Wait()
-
-		// Log failed videos.
-		muFailed.Lock()
-		batch.bp.logFailedVideos()
-		muFailed.Unlock()
-
-		// Release the batch processor back to the pool.
-		batch.bp.release()
-	}()
-}
@@ -9,6 +9,7 @@ import (
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
 	"metarr/internal/models"
+	"metarr/internal/progress"
 	"os"
 	"strings"
 	"sync"
@@ -142,7 +143,7 @@ func sysResourceLoop(ctx context.Context, fileStr string) {
 		muResource.Unlock()
 
 		if err != nil {
-			vars.AddToErrorArray(err)
+			vars.AddError(vars.ErrOther, "", err)
 			logger.Pl.E("Error checking system resources: %v", err)
 
 			time.Sleep(backoff)
@@ -195,8 +196,9 @@ func printProgress(fileType string, current, total int32, directory string) {
 	muPrint.Lock()
 	defer muPrint.Unlock()
 
-	fmt.Fprintf(os.Stderr, "\n==============================================================\n")
-	fmt.Fprintf(os.Stderr, "    Processed %s file %d of %d\n", fileType, current, total)
-	fmt.Fprintf(os.Stderr, "    Remaining in %q: %d\n", directory, total-current)
-	fmt.Fprintf(os.Stderr, "==============================================================\n\n")
+	fmt.Fprintf(progress.Stderr, "\n==============================================================\n"+
+		"    Processed %s file %d of %d\n"+
+		"    Remaining in %q: %d\n"+
+		"==============================================================\n\n",
+		fileType, current, total, directory, total-current)
 }
@@ -11,9 +11,11 @@ import (
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
 	"metarr/internal/ffprobe"
+	"metarr/internal/metadata/fieldsfilename"
 	"metarr/internal/metadata/fieldsjson"
 	"metarr/internal/metadata/metawriters"
 	"metarr/internal/models"
+	"metarr/internal/plan"
 	"metarr/internal/transformations"
 	"os"
 	"path/filepath"
@@ -39,10 +41,25 @@ func processJSONFile(ctx context.Context, fd *models.FileData) error {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
+	// Work on a scratch copy in dry-run mode.
+	openPath := filePath
+	if plan.Enabled() {
+		scratchPath, cleanup, err := plan.ScratchCopy(filePath)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		defer func() {
+			if err := plan.RecordMetaDiff(fd, filePath, scratchPath); err != nil {
+				logger.Pl.E("Failed to record metadata changes for %q: %v", filePath, err)
+			}
+		}()
+		openPath = scratchPath
+	}
+
 	// Open the file.
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0o644)
+	file, err := os.OpenFile(openPath, os.O_RDWR, 0o644)
 	if err != nil {
-		vars.AddToErrorArray(err)
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() {
@@ -57,7 +74,7 @@ func processJSONFile(ctx context.Context, fd *models.FileData) error {
 	// Decode metadata from file.
 	data, err := jsonRW.DecodeJSON(file)
 	if err != nil {
-		return err
+		return vars.NewError(vars.ErrMetaDecode, filePath, err)
 	}
 	if data == nil {
 		return fmt.Errorf("json decoded nil for file %q", file.Name())
@@ -84,9 +101,16 @@ func processJSONFile(ctx context.Context, fd *models.FileData) error {
 		}
 	}
 
+	// Fields captured from the filename fill gaps in the metafile.
+	nameFields := fieldsfilename.Parse(fd)
+
 	// Fill timestamps and make/delete date tag amendments.
 	if ok = fieldsjson.FillTimestamps(fd, data, jsonRW); !ok {
-		logger.Pl.I("No date metadata found")
+		if fieldsfilename.FillDates(fd, nameFields) {
+			logger.Pl.I("Filled dates from filename %q", fd.OriginalVideoPath)
+		} else {
+			logger.Pl.I("No date metadata found")
+		}
 	}
 	if fd.MDates.FormattedDate == "" {
 		dates.FormatAllDates(fd)
@@ -114,6 +138,7 @@ func processJSONFile(ctx context.Context, fd *models.FileData) error {
 	if data, ok = fieldsjson.FillJSONFields(fd, data, jsonRW); !ok {
 		logger.Pl.D(2, "Some metafields were unfilled")
 	}
+	fieldsfilename.FillFields(fd, nameFields)
 
 	// Construct date tag:
 	logger.Pl.D(1, "About to make date tag for: %v", file.Name())
@@ -167,7 +192,7 @@ func filetypeMetaCheckSwitch(ctx context.Context, fd *models.FileData) bool {
 
 	// Write thumbnail.
 	if abstractions.IsSet(keys.ForceWriteThumbnails) {
-		if abstractions.GetBool(keys.ForceWriteThumbnails) && fd.MWebData.Thumbnail != "" {
+		if abstractions.GetBool(keys.ForceWriteThumbnails) && fd.ThumbnailSource() != "" {
 			logger.Pl.I("Skipping FFprobe, thumbnail enforcing write.")
 			return false
 		}
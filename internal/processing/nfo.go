@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"metarr/internal/domain/logger"
 	"metarr/internal/domain/vars"
+	"metarr/internal/metadata/fieldsfilename"
 	"metarr/internal/metadata/fieldsnfo"
 	"metarr/internal/metadata/metawriters"
 	"metarr/internal/models"
+	"metarr/internal/plan"
 	"os"
 	"sync"
 )
@@ -33,10 +35,25 @@ func processNFOFiles(ctx context.Context, fd *models.FileData) error {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
+	// Work on a scratch copy in dry-run mode.
+	openPath := filePath
+	if plan.Enabled() {
+		scratchPath, cleanup, err := plan.ScratchCopy(filePath)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		defer func() {
+			if err := plan.RecordMetaDiff(fd, filePath, scratchPath); err != nil {
+				logger.Pl.E("Failed to record metadata changes for %q: %v", filePath, err)
+			}
+		}()
+		openPath = scratchPath
+	}
+
 	// Open the file.
-	file, err := os.OpenFile(fd.MetaFilePath, os.O_RDWR, 0o644)
+	file, err := os.OpenFile(openPath, os.O_RDWR, 0o644)
 	if err != nil {
-		vars.AddToErrorArray(err)
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() {
@@ -49,6 +66,7 @@ func processNFOFiles(ctx context.Context, fd *models.FileData) error {
 
 	nfoData, err := nfoRW.DecodeMetadata(file)
 	if err != nil || nfoData == nil {
+		vars.AddError(vars.ErrMetaDecode, filePath, err)
 		logger.Pl.E("Failed to decode metadata from file: %v", err)
 	} else {
 		// Store NFO data in model.
@@ -72,5 +90,10 @@ func processNFOFiles(ctx context.Context, fd *models.FileData) error {
 	if ok := fieldsnfo.FillNFO(fd); !ok {
 		logger.Pl.E("No metadata filled from NFO file...")
 	}
+
+	// Fields captured from the filename fill gaps in the metafile.
+	nameFields := fieldsfilename.Parse(fd)
+	fieldsfilename.FillDates(fd, nameFields)
+	fieldsfilename.FillFields(fd, nameFields)
 	return nil
 }
@@ -0,0 +1,208 @@
+package processing
+
+import (
+	"context"
+	"metarr/internal/domain/logger"
+	"metarr/internal/events"
+	"metarr/internal/models"
+	"metarr/internal/progress"
+	"metarr/internal/report"
+	"metarr/internal/state"
+	"metarr/internal/transformations"
+	"runtime/debug"
+	"sync"
+)
+
+// Pipeline processes each pair's metadata, then its video, on worker pools shared by every batch.
+//
+// Metadata workers (which may scrape the web) and video workers (FFmpeg) have separate limits, so a pair's
+// video starts as soon as its metadata is done, and a slow batch doesn't hold up the rest. A server keeps
+// one pipeline for all its jobs.
+type Pipeline struct {
+	metaJobs     chan workItem
+	videoJobs    chan workItem
+	metaWorkers  sync.WaitGroup
+	videoWorkers sync.WaitGroup
+}
+
+// StartPipeline starts 'metaN' metadata workers and 'videoN' video workers.
+//
+// Video workers have IDs 1 to videoN, metadata workers follow on from them.
+func StartPipeline(metaN, videoN int) *Pipeline {
+	metaN, videoN = max(metaN, 1), max(videoN, 1)
+	p := &Pipeline{
+		metaJobs:  make(chan workItem, metaN*2),
+		videoJobs: make(chan workItem, videoN*2),
+	}
+	for id := 1; id <= videoN; id++ {
+		p.videoWorkers.Add(1)
+		go p.videoWorker(id)
+	}
+	for id := videoN + 1; id <= videoN+metaN; id++ {
+		p.metaWorkers.Add(1)
+		go p.metaWorker(id)
+	}
+	return p
+}
+
+// Stop stops the workers once the queues are empty.
+//
+// Nothing may be submitted after Stop is called.
+func (p *Pipeline) Stop() {
+	close(p.metaJobs)
+	p.metaWorkers.Wait()
+	close(p.videoJobs)
+	p.videoWorkers.Wait()
+}
+
+// submit queues a pair, blocking while the queue is full.
+func (p *Pipeline) submit(job workItem) {
+	job.batch.pending.Add(1)
+	p.metaJobs <- job
+}
+
+// run tracks the batches of a single ProcessBatches call and the files they processed.
+type run struct {
+	ctx     context.Context
+	batches sync.WaitGroup // Batches waiting on their files.
+
+	mu      sync.Mutex
+	results []*models.FileData
+}
+
+// onBatchDone runs 'done' once every pair submitted for the batch has finished.
+//
+// Must be called after the batch's last submit.
+func (r *run) onBatchDone(b *batch, done func()) {
+	r.batches.Add(1)
+	go func() {
+		defer r.batches.Done()
+		b.pending.Wait()
+		done()
+	}()
+}
+
+// addResult stores a file processed successfully.
+func (r *run) addResult(fd *models.FileData) {
+	r.mu.Lock()
+	r.results = append(r.results, fd)
+	r.mu.Unlock()
+}
+
+// wait waits for every batch of the run, and returns the files processed successfully.
+func (r *run) wait() []*models.FileData {
+	r.batches.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results
+}
+
+// metaWorker processes queued metadata, then passes each pair on to the video workers.
+func (p *Pipeline) metaWorker(id int) {
+	defer p.metaWorkers.Done()
+
+	progress.SetWorker(id, 0, progress.StageIdle, "")
+	defer progress.RemoveWorker(id)
+
+	for job := range p.metaJobs {
+		if p.processMeta(id, job) {
+			p.videoJobs <- job
+		} else {
+			job.batch.pending.Done()
+		}
+	}
+}
+
+// processMeta runs a single pair's metadata, returning false if the pair should go no further.
+//
+// Pairs go on to the video stage even if their metadata failed.
+func (p *Pipeline) processMeta(id int, job workItem) (forward bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Pl.E("Worker %d panicked: %v\n%s", id, r, debug.Stack())
+			forward = false
+		}
+	}()
+
+	// Drain the queue without processing after cancellation, so batches still finish.
+	ctx := job.batch.run.ctx
+	if ctx.Err() != nil {
+		logger.Pl.D(1, "Worker %d skipping %q due to context cancellation", id, job.filename)
+		return false
+	}
+
+	progress.SetWorker(id, job.batch.ID, progress.StageMetadata, job.fileData.MetaFilePath)
+	defer progress.SetWorker(id, 0, progress.StageIdle, "")
+
+	processMetadata(ctx, job.batch.bp, job.filename, job.fileData)
+	return true
+}
+
+// videoWorker processes queued videos until the pipeline is stopped.
+func (p *Pipeline) videoWorker(id int) {
+	defer p.videoWorkers.Done()
+
+	progress.SetWorker(id, 0, progress.StageIdle, "")
+	defer progress.RemoveWorker(id)
+
+	for job := range p.videoJobs {
+		p.processVideo(id, job)
+	}
+}
+
+// processVideo runs a single file, then renames and moves it, marking it done in its batch.
+func (p *Pipeline) processVideo(id int, job workItem) {
+	defer job.batch.pending.Done()
+	defer func() {
+		if job.fileData.Failed {
+			state.RecordFailure(job.fileData)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Pl.E("Worker %d panicked: %v\n%s", id, r, debug.Stack())
+		}
+	}()
+
+	// Drain the queue without processing after cancellation, so batches still finish.
+	ctx := job.batch.run.ctx
+	if ctx.Err() != nil {
+		logger.Pl.D(1, "Worker %d skipping %q due to context cancellation", id, job.filename)
+		return
+	}
+	logger.Pl.D(1, "Worker %d processing file: %s", id, job.filename)
+
+	current := job.fileData.OriginalVideoPath
+	if current == "" {
+		current = job.fileData.MetaFilePath
+	}
+	progress.SetWorker(id, job.batch.ID, progress.StageVideo, current)
+	defer progress.SetWorker(id, 0, progress.StageIdle, "")
+
+	executed, err := executeFile(ctx, job.batch.bp, job.skipVids, job.filename, job.fileData)
+	if err != nil {
+		logger.Pl.E("Worker %d error executing file %q: %v", id, job.filename, err)
+		return
+	}
+
+	if executed != nil {
+		// Rename and move now, so finished files appear without waiting for the rest of the run.
+		progress.SetWorker(id, job.batch.ID, progress.StageRename, current)
+		if err := transformations.RenameFile(ctx, executed, job.skipVids); err != nil {
+			events.Publish(events.Event{
+				Type:  events.FileFailed,
+				Video: executed.OriginalVideoPath,
+				Meta:  executed.MetaFilePath,
+				Error: err.Error(),
+			})
+			job.batch.bp.addFailure(failedVideo{
+				filename: job.filename,
+				stage:    report.StageRename,
+				err:      err.Error(),
+			})
+		}
+
+		job.batch.run.addResult(executed)
+	}
+}
@@ -0,0 +1,152 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+const (
+	ttyInterval   = time.Second
+	plainInterval = 30 * time.Second
+	barWidth      = 10
+)
+
+// Stderr is the progress-aware console for standard error. Terminal output written during processing should go here.
+var Stderr = NewConsole(os.Stderr)
+
+// Console wraps the terminal writer so log lines and the live progress block don't overwrite each other.
+type Console struct {
+	mu    sync.Mutex
+	out   io.Writer
+	tty   bool
+	lines int // Progress lines currently drawn below the log output.
+}
+
+// NewConsole returns a Console writing to the given file.
+func NewConsole(f *os.File) *Console {
+	c := &Console{out: f}
+	if info, err := f.Stat(); err == nil {
+		c.tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return c
+}
+
+// Write clears the progress block, writes p, and redraws the block underneath.
+func (c *Console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clear()
+	n, err := c.out.Write(p)
+	c.draw()
+	return n, err
+}
+
+// Run redraws progress until the context is cancelled.
+//
+// Terminals get a live block of one line per job, other outputs get a plain report every 30 seconds.
+func (c *Console) Run(ctx context.Context) {
+	interval := plainInterval
+	if c.tty {
+		interval = ttyInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.clear()
+			c.mu.Unlock()
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.tty {
+				c.clear()
+				c.draw()
+			} else if report := render(false); report != "" {
+				fmt.Fprint(c.out, report)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// clear erases the drawn progress block. Must be called under lock.
+func (c *Console) clear() {
+	if c.lines == 0 {
+		return
+	}
+	fmt.Fprintf(c.out, "\033[%dA\r\033[J", c.lines)
+	c.lines = 0
+}
+
+// draw prints the progress block. Must be called under lock.
+func (c *Console) draw() {
+	if !c.tty {
+		return
+	}
+	block := render(true)
+	if block == "" {
+		return
+	}
+	fmt.Fprint(c.out, block)
+	c.lines = strings.Count(block, "\n")
+}
+
+// render formats one line per running job plus a summary line.
+func render(color bool) string {
+	statuses := Snapshot()
+	if len(statuses) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, s := range statuses {
+		name := []rune(filepath.Base(s.File))
+		if len(name) > 28 {
+			name = append(name[:25], []rune("...")...)
+		}
+
+		if s.Duration > 0 {
+			filled := int(s.Percent / 100 * barWidth)
+			fmt.Fprintf(&b, "%-28s [%s%s] %5.1f%%", string(name), strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), s.Percent)
+		} else {
+			fmt.Fprintf(&b, "%-28s %s", string(name), formatDuration(s.OutTime))
+		}
+		fmt.Fprintf(&b, "  %.1f fps  %.2fx", s.FPS, s.Speed)
+		if s.ETASeconds > 0 {
+			fmt.Fprintf(&b, "  ETA %s", formatDuration(s.ETASeconds))
+		}
+		b.WriteByte('\n')
+	}
+
+	sum := Aggregate()
+	if color {
+		b.WriteString(sharedconsts.ColorCyan)
+	}
+	fmt.Fprintf(&b, "FFmpeg: %d running, %d finished", sum.Active, sum.Finished)
+	if sum.ETASeconds > 0 {
+		fmt.Fprintf(&b, ", all running done in %s", formatDuration(sum.ETASeconds))
+	}
+	if color {
+		b.WriteString(sharedconsts.ColorReset)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// formatDuration formats seconds as H:MM:SS.
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds) * time.Second
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,45 @@
+package progress
+
+import (
+	"metarr/internal/events"
+	"strings"
+	"testing"
+)
+
+func TestTrackEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports []string // Value of each report's 'progress' key.
+		want    int
+	}{
+		{"first report", []string{"continue"}, 1},
+		{"reports within the interval", []string{"continue", "continue", "continue"}, 1},
+		{"final report is always sent", []string{"continue", "continue", "end"}, 2},
+		{"no reports", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, unsubscribe := events.Subscribe(16)
+			defer unsubscribe()
+
+			var b strings.Builder
+			for _, r := range tt.reports {
+				b.WriteString("out_time_us=1000000\nprogress=" + r + "\n")
+			}
+			job := Start(tt.name, 10)
+			job.Track(strings.NewReader(b.String()))
+			job.Finish()
+
+			got := 0
+			for len(ch) > 0 {
+				if e := <-ch; e.Type == events.FFmpegProgress && e.Video == tt.name {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("published %d progress event(s), want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Package progress tracks live FFmpeg progress for running jobs and draws it in the terminal.
+package progress
+
+import (
+	"bufio"
+	"io"
+	"metarr/internal/events"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is a point-in-time snapshot of a running FFmpeg job.
+type Status struct {
+	ID         int       `json:"id"`
+	File       string    `json:"file"`
+	Started    time.Time `json:"started"`
+	Duration   float64   `json:"duration_seconds"` // Input duration (0 if unknown).
+	OutTime    float64   `json:"out_time_seconds"` // Position FFmpeg has written up to.
+	Percent    float64   `json:"percent"`          // 0-100 (0 if duration unknown).
+	FPS        float64   `json:"fps"`              // Frames encoded per second.
+	Speed      float64   `json:"speed"`            // Multiple of realtime.
+	ETASeconds float64   `json:"eta_seconds"`      // Estimated time remaining (0 if unknown).
+	Updated    time.Time `json:"updated"`          // Time of last progress report.
+}
+
+// Summary aggregates all running jobs.
+type Summary struct {
+	Active     int     `json:"active"`
+	Finished   int     `json:"finished"`
+	ETASeconds float64 `json:"eta_seconds"` // Time until every running job is done (0 if unknown).
+}
+
+// eventInterval is the least time between progress events for a job (the final report is always sent).
+const eventInterval = 5 * time.Second
+
+// Job is a running FFmpeg job registered with the tracker.
+type Job struct {
+	id int
+}
+
+var (
+	mu       sync.Mutex
+	nextID   int
+	jobs     = make(map[int]*Status)
+	finished int
+)
+
+// Start registers a new job. Duration is the input duration in seconds (0 if unknown).
+func Start(file string, duration float64) *Job {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nextID++
+	now := time.Now()
+	jobs[nextID] = &Status{
+		ID:       nextID,
+		File:     file,
+		Started:  now,
+		Duration: duration,
+		Updated:  now,
+	}
+	return &Job{id: nextID}
+}
+
+// Finish removes a job from the tracker.
+func (j *Job) Finish() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := jobs[j.id]; exists {
+		delete(jobs, j.id)
+		finished++
+	}
+}
+
+// update applies a block of FFmpeg progress values to the job, returning its new status.
+func (j *Job) update(values map[string]string) (Status, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, exists := jobs[j.id]
+	if !exists {
+		return Status{}, false
+	}
+	s.Updated = time.Now()
+
+	// 'out_time_ms' is in microseconds despite the name, prefer the explicit key.
+	us := values["out_time_us"]
+	if us == "" {
+		us = values["out_time_ms"]
+	}
+	if v, err := strconv.ParseInt(us, 10, 64); err == nil && v >= 0 {
+		s.OutTime = float64(v) / 1e6
+	}
+	if v, err := strconv.ParseFloat(values["fps"], 64); err == nil {
+		s.FPS = v
+	}
+	if v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(values["speed"]), "x"), 64); err == nil {
+		s.Speed = v
+	}
+
+	if s.Duration <= 0 {
+		return *s, true
+	}
+	s.Percent = min(s.OutTime/s.Duration*100, 100)
+
+	remaining := max(s.Duration-s.OutTime, 0)
+	switch {
+	case s.Speed > 0:
+		s.ETASeconds = remaining / s.Speed
+	case s.OutTime > 0:
+		s.ETASeconds = remaining * time.Since(s.Started).Seconds() / s.OutTime
+	}
+	return *s, true
+}
+
+// Track reads FFmpeg '-progress' output until EOF, updating the job after each report.
+//
+// Progress events are published at most once per eventInterval, and for the final report.
+func (j *Job) Track(r io.Reader) {
+	var lastEvent time.Time
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, val, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		values[key] = val
+
+		// Each report block ends with 'progress=continue' or 'progress=end'.
+		if key == "progress" {
+			s, ok := j.update(values)
+			if ok && (val == "end" || time.Since(lastEvent) >= eventInterval) {
+				lastEvent = time.Now()
+				events.Publish(events.Event{
+					Type:  events.FFmpegProgress,
+					Video: s.File,
+					Progress: &events.Progress{
+						Percent:    s.Percent,
+						OutTime:    s.OutTime,
+						Duration:   s.Duration,
+						Speed:      s.Speed,
+						ETASeconds: s.ETASeconds,
+					},
+				})
+			}
+			values = make(map[string]string)
+		}
+	}
+}
+
+// Snapshot returns the status of all running jobs, oldest first.
+func Snapshot() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := make([]Status, 0, len(jobs))
+	for _, s := range jobs {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, k int) bool {
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
+
+// Aggregate returns a summary of all jobs.
+func Aggregate() Summary {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sum := Summary{
+		Active:   len(jobs),
+		Finished: finished,
+	}
+	for _, s := range jobs {
+		sum.ETASeconds = max(sum.ETASeconds, s.ETASeconds)
+	}
+	return sum
+}
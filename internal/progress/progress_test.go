@@ -0,0 +1,147 @@
+package progress
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		output   string
+		want     Status
+	}{
+		{
+			name:     "single report",
+			duration: 100,
+			output:   "frame=250\nfps=25.00\nout_time_us=10000000\nspeed=2.00x\nprogress=continue\n",
+			want:     Status{OutTime: 10, Percent: 10, FPS: 25, Speed: 2, ETASeconds: 45},
+		},
+		{
+			name:     "latest report wins",
+			duration: 60,
+			output: "out_time_us=6000000\nspeed=1x\nprogress=continue\n" +
+				"out_time_us=30000000\nspeed=3x\nprogress=continue\n",
+			want: Status{OutTime: 30, Percent: 50, Speed: 3, ETASeconds: 10},
+		},
+		{
+			name:     "out_time_ms is in microseconds",
+			duration: 10,
+			output:   "out_time_ms=5000000\nspeed= 1.5x\nprogress=continue\n",
+			want:     Status{OutTime: 5, Percent: 50, Speed: 1.5, ETASeconds: 5.0 / 1.5},
+		},
+		{
+			name:     "negative time is ignored",
+			duration: 10,
+			output:   "out_time_us=-9223372036854775807\nspeed=N/A\nprogress=continue\n",
+			want:     Status{},
+		},
+		{
+			name:     "percent stops at 100",
+			duration: 10,
+			output:   "out_time_us=10400000\nspeed=4x\nprogress=end\n",
+			want:     Status{OutTime: 10.4, Percent: 100, Speed: 4},
+		},
+		{
+			name:     "unknown duration",
+			duration: 0,
+			output:   "fps=30\nout_time_us=2000000\nspeed=2x\nprogress=continue\n",
+			want:     Status{OutTime: 2, FPS: 30, Speed: 2},
+		},
+		{
+			name:     "unfinished report is not applied",
+			duration: 10,
+			output:   "out_time_us=2000000\nspeed=1x\nprogress=continue\nout_time_us=4000000\n",
+			want:     Status{OutTime: 2, Percent: 20, Speed: 1, ETASeconds: 8},
+		},
+		{
+			name:     "lines without values are skipped",
+			duration: 10,
+			output:   "\ngarbage\n  out_time_us=1000000  \nspeed=3x\nprogress=continue\n",
+			want:     Status{OutTime: 1, Percent: 10, Speed: 3, ETASeconds: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Start(tt.name, tt.duration)
+			defer job.Finish()
+
+			job.Track(strings.NewReader(tt.output))
+
+			var got Status
+			for _, s := range Snapshot() {
+				if s.File == tt.name {
+					got = s
+				}
+			}
+			fields := []struct {
+				name      string
+				got, want float64
+			}{
+				{"OutTime", got.OutTime, tt.want.OutTime},
+				{"Percent", got.Percent, tt.want.Percent},
+				{"FPS", got.FPS, tt.want.FPS},
+				{"Speed", got.Speed, tt.want.Speed},
+				{"ETASeconds", got.ETASeconds, tt.want.ETASeconds},
+			}
+			for _, f := range fields {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	before := Aggregate()
+
+	a := Start("a", 100)
+	b := Start("b", 100)
+	a.Track(strings.NewReader("out_time_us=50000000\nspeed=1x\nprogress=continue\n"))
+	b.Track(strings.NewReader("out_time_us=80000000\nspeed=2x\nprogress=continue\n"))
+
+	tests := []struct {
+		name    string
+		finish  *Job
+		want    Summary
+		wantIDs int
+	}{
+		{"two running", nil, Summary{Active: 2, Finished: before.Finished, ETASeconds: 50}, 2},
+		{"slowest finished", a, Summary{Active: 1, Finished: before.Finished + 1, ETASeconds: 10}, 1},
+		{"finish twice", a, Summary{Active: 1, Finished: before.Finished + 1, ETASeconds: 10}, 1},
+		{"all finished", b, Summary{Active: 0, Finished: before.Finished + 2}, 0},
+	}
+	for _, tt := range tests {
+		if tt.finish != nil {
+			tt.finish.Finish()
+		}
+		if got := Aggregate(); got != tt.want {
+			t.Errorf("%s: Aggregate() = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got := len(Snapshot()); got != tt.wantIDs {
+			t.Errorf("%s: %d jobs in snapshot, want %d", tt.name, got, tt.wantIDs)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{0, "0:00:00"},
+		{59.9, "0:00:59"},
+		{61, "0:01:01"},
+		{3600, "1:00:00"},
+		{36000 + 59*60 + 1, "10:59:01"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.seconds); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
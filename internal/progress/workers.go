@@ -0,0 +1,81 @@
+package progress
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Worker stages.
+const (
+	StageIdle     = "idle"
+	StagePairing  = "pairing"
+	StageMetadata = "metadata"
+	StageVideo    = "video"
+	StageRename   = "rename"
+)
+
+// BatchWorker is the worker ID used for pairing batches.
+const BatchWorker = 0
+
+// WorkerStatus is what a worker is doing.
+type WorkerStatus struct {
+	ID     int       `json:"id"`
+	Batch  int64     `json:"batch,omitempty"`
+	Stage  string    `json:"stage"`
+	File   string    `json:"file,omitempty"`
+	Since  time.Time `json:"since"`            // When the worker entered this stage.
+	FFmpeg *Status   `json:"ffmpeg,omitempty"` // Live FFmpeg progress for the file, if running.
+}
+
+var (
+	workersMu sync.Mutex
+	workers   = make(map[int]*WorkerStatus)
+)
+
+// SetWorker records the stage and file a worker is on.
+func SetWorker(id int, batch int64, stage, file string) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+
+	w, exists := workers[id]
+	if !exists {
+		w = &WorkerStatus{ID: id}
+		workers[id] = w
+	}
+	if w.Stage != stage || w.File != file || w.Batch != batch {
+		w.Since = time.Now()
+	}
+	w.Batch, w.Stage, w.File = batch, stage, file
+}
+
+// RemoveWorker drops a worker once it exits.
+func RemoveWorker(id int) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	delete(workers, id)
+}
+
+// Workers returns the status of all workers by ID, with FFmpeg progress for files being encoded.
+func Workers() []WorkerStatus {
+	running := make(map[string]Status)
+	for _, s := range Snapshot() {
+		running[s.File] = s
+	}
+
+	workersMu.Lock()
+	defer workersMu.Unlock()
+
+	out := make([]WorkerStatus, 0, len(workers))
+	for _, w := range workers {
+		ws := *w
+		if s, ok := running[w.File]; ok && w.Stage == StageVideo {
+			ws.FFmpeg = &s
+		}
+		out = append(out, ws)
+	}
+	sort.Slice(out, func(i, k int) bool {
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
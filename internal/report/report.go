@@ -0,0 +1,315 @@
+// Package report builds a machine-readable summary of each run, listing every pair with its stages, paths and errors.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/keys"
+	"metarr/internal/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stages.
+const (
+	StageScan   = "scan" // Reading batch directories and files.
+	StageMeta   = "meta"
+	StageFFmpeg = "ffmpeg"
+	StageRename = "rename"
+	StageMove   = "move"
+	StagePurge  = "purge"
+)
+
+// Pair statuses.
+const (
+	statusDone       = "done"
+	statusFailed     = "failed"
+	statusIncomplete = "incomplete" // No error, but never reached its final paths (e.g. cancelled).
+)
+
+// Stage is a single stage run on a pair.
+type Stage struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Error is a failure in a stage.
+type Error struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+}
+
+// Failure is a failure recorded by a batch.
+type Failure struct {
+	Batch int64  `json:"batch"`
+	File  string `json:"file"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// Pair is the outcome for a video/metadata pair.
+type Pair struct {
+	Batch           int64    `json:"batch"`
+	Status          string   `json:"status"`
+	Video           string   `json:"video,omitempty"`
+	Meta            string   `json:"meta,omitempty"`
+	FinalVideo      string   `json:"final_video,omitempty"`
+	FinalMeta       string   `json:"final_meta,omitempty"`
+	Stages          []Stage  `json:"stages"`
+	FFmpegArgv      []string `json:"ffmpeg_argv,omitempty"`
+	Duration        float64  `json:"duration_seconds"` // Total across stages.
+	VideoBytes      int64    `json:"video_bytes,omitempty"`
+	MetaBytes       int64    `json:"meta_bytes,omitempty"`
+	FinalVideoBytes int64    `json:"final_video_bytes,omitempty"`
+	FinalMetaBytes  int64    `json:"final_meta_bytes,omitempty"`
+	Errors          []Error  `json:"errors,omitempty"`
+
+	fd *models.FileData
+}
+
+// Run is the report for a run.
+type Run struct {
+	RunID    string    `json:"run_id,omitempty"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration float64   `json:"duration_seconds"`
+	Error    string    `json:"error,omitempty"`
+	Totals   struct {
+		Pairs      int `json:"pairs"`
+		Done       int `json:"done"`
+		Failed     int `json:"failed"`
+		Incomplete int `json:"incomplete"`
+	} `json:"totals"`
+	Pairs    []*Pair   `json:"pairs"`
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	started  time.Time
+	pairs    = make(map[string]*Pair)
+	failures []Failure
+)
+
+// Enabled returns true if a report was requested.
+func Enabled() bool {
+	return abstractions.GetString(keys.Report) != ""
+}
+
+// Start clears the previous run's report.
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+	started = time.Now()
+	pairs = make(map[string]*Pair)
+	failures = nil
+}
+
+// get returns (creating if needed) the entry for a file pair. Must be called under lock.
+func get(fd *models.FileData) *Pair {
+	key := fd.OriginalVideoPath
+	if key == "" {
+		key = fd.MetaFilePath
+	}
+	p, exists := pairs[key]
+	if !exists {
+		p = &Pair{
+			Video:  fd.OriginalVideoPath,
+			Meta:   fd.MetaFilePath,
+			Stages: []Stage{},
+			fd:     fd,
+		}
+		pairs[key] = p
+	}
+	return p
+}
+
+// Add records a pair about to be processed in a batch, with its input sizes.
+func Add(fd *models.FileData, batch int64) {
+	if fd == nil || !Enabled() {
+		return
+	}
+	videoSize, metaSize := fileSize(fd.OriginalVideoPath), fileSize(fd.MetaFilePath)
+
+	mu.Lock()
+	defer mu.Unlock()
+	p := get(fd)
+	p.Batch = batch
+	p.VideoBytes, p.MetaBytes = videoSize, metaSize
+}
+
+// AddStage records a stage which ran on a pair since 'start', and its error if it failed.
+func AddStage(fd *models.FileData, name string, start time.Time, err error) {
+	if fd == nil || !Enabled() {
+		return
+	}
+	s := Stage{
+		Name:     name,
+		Duration: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	p := get(fd)
+	p.Stages = append(p.Stages, s)
+	if err != nil {
+		p.Errors = append(p.Errors, Error{Stage: name, Message: err.Error()})
+	}
+}
+
+// AddError records a pair's failure outside a timed stage.
+//
+// Errors wrapping one already recorded for the pair (e.g. by its stage) are skipped.
+func AddError(fd *models.FileData, stage string, err error) {
+	if fd == nil || err == nil || !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	p := get(fd)
+	msg := err.Error()
+	for _, e := range p.Errors {
+		if strings.Contains(msg, e.Message) {
+			return
+		}
+	}
+	p.Errors = append(p.Errors, Error{Stage: stage, Message: msg})
+}
+
+// SetFFmpegArgv records the FFmpeg command run on a pair.
+func SetFFmpegArgv(fd *models.FileData, args []string) {
+	if fd == nil || !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	get(fd).FFmpegArgv = append([]string{"ffmpeg"}, args...)
+}
+
+// AddFailure records a batch failure.
+func AddFailure(f Failure) {
+	if !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	failures = append(failures, f)
+}
+
+// Finish writes the run's report to the configured path.
+//
+// A '.jsonl' path has one line appended per run, anything else is overwritten with the latest run.
+func Finish(runID string, runErr error) (string, error) {
+	path := abstractions.GetString(keys.Report)
+	if path == "" {
+		return "", nil
+	}
+	r := build(runID, runErr)
+
+	if err := os.MkdirAll(filepath.Dir(path), consts.PermsHomeMetarrDir); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode report: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, consts.PermsJSONFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to open report %q: %w", path, err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			_ = f.Close()
+			return "", fmt.Errorf("failed to write report %q: %w", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return "", fmt.Errorf("failed to close report %q: %w", path, err)
+		}
+		return path, nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), consts.PermsJSONFile); err != nil {
+		return "", fmt.Errorf("failed to write report %q: %w", path, err)
+	}
+	return path, nil
+}
+
+// build assembles the run's report, sorted by path.
+func build(runID string, runErr error) *Run {
+	mu.Lock()
+	defer mu.Unlock()
+
+	r := &Run{
+		RunID:    runID,
+		DryRun:   abstractions.GetBool(keys.DryRun),
+		Started:  started,
+		Finished: time.Now(),
+		Pairs:    make([]*Pair, 0, len(pairs)),
+		Failures: failures,
+	}
+	r.Duration = r.Finished.Sub(r.Started).Seconds()
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+
+	for _, p := range pairs {
+		p.FinalVideo, p.FinalMeta = p.fd.FinalVideoPath, p.fd.FinalMetaPath
+		if !r.DryRun {
+			p.FinalVideoBytes, p.FinalMetaBytes = fileSize(p.FinalVideo), fileSize(p.FinalMeta)
+		}
+		p.Duration = 0
+		for _, s := range p.Stages {
+			p.Duration += s.Duration
+		}
+
+		switch {
+		case len(p.Errors) > 0:
+			p.Status = statusFailed
+			r.Totals.Failed++
+		case p.FinalVideo != "" || p.FinalMeta != "":
+			p.Status = statusDone
+			r.Totals.Done++
+		default:
+			p.Status = statusIncomplete
+			r.Totals.Incomplete++
+		}
+		r.Pairs = append(r.Pairs, p)
+	}
+	r.Totals.Pairs = len(r.Pairs)
+
+	sort.Slice(r.Pairs, func(i, j int) bool {
+		if r.Pairs[i].Video != r.Pairs[j].Video {
+			return r.Pairs[i].Video < r.Pairs[j].Video
+		}
+		return r.Pairs[i].Meta < r.Pairs[j].Meta
+	})
+	return r
+}
+
+// fileSize returns the size of a file, or 0 if it can't be read.
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
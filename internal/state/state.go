@@ -0,0 +1,293 @@
+// Package state persists per-file processing state so unchanged files can be skipped on later runs.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metarr/internal/abstractions"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/keys"
+	"metarr/internal/domain/logger"
+	"metarr/internal/domain/paths"
+	"metarr/internal/models"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFile = "state.json"
+
+// configKeys are the settings which affect the output of a processed file.
+var configKeys = []string{
+	keys.MetaOpsInput,
+	keys.FilenameOpsInput,
+	keys.FilenamePatterns,
+	keys.RenameStyle,
+	keys.MOverwrite,
+	keys.MPreserve,
+	keys.MetaPurge,
+	keys.NoFileOverwrite,
+	keys.OutputDirectory,
+	keys.OutputFiletype,
+	keys.SkipVideos,
+	keys.TranscodeGPU,
+	keys.TranscodeGPUNode,
+	keys.TranscodeVideoCodecInput,
+	keys.TranscodeAudioCodecInput,
+	keys.TranscodePreset,
+	keys.TranscodeQuality,
+	keys.TranscodeVideoFilter,
+	keys.ExtraFFmpegArgs,
+	keys.ForceWriteThumbnails,
+	keys.StripThumbnails,
+	keys.VerifyOutput,
+	keys.AudioLanguages,
+	keys.SubtitleLanguages,
+	keys.DropStreamTypes,
+	keys.DropDispositions,
+	keys.ForcedSubtitlesOnly,
+	keys.MuxSubtitles,
+	keys.SubtitleSidecars,
+	keys.ThumbnailSidecars,
+	keys.StubMetadata,
+	keys.MatchStrategies,
+}
+
+// fileStat holds the identifying attributes of a file on disk.
+type fileStat struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// record is the stored state for a processed video/metadata pair.
+type record struct {
+	Video      fileStat  `json:"video"`
+	Meta       fileStat  `json:"meta"`
+	ConfigHash string    `json:"config_hash"`
+	Updated    time.Time `json:"updated"`
+}
+
+// store holds all records for the current run.
+type store struct {
+	mu         sync.Mutex
+	path       string
+	configHash string
+	records    map[string]record
+	failures   map[string]record // Pairs which failed in watch mode, kept in memory only.
+	dirty      bool
+}
+
+var current *store
+
+// Load reads the state file from the Metarr home directory.
+func Load() error {
+	s := &store{
+		path:       filepath.Join(paths.HomeMetarrDir, stateFile),
+		configHash: hashConfig(),
+		records:    make(map[string]record),
+		failures:   make(map[string]record),
+	}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		logger.Pl.D(1, "No state file found at %q, starting fresh", s.path)
+	case err != nil:
+		return fmt.Errorf("failed to read state file %q: %w", s.path, err)
+	default:
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			logger.Pl.W("State file %q is corrupt, starting fresh: %v", s.path, err)
+			s.records = make(map[string]record)
+		}
+	}
+	current = s
+	return nil
+}
+
+// Unchanged returns true if the file pair was processed previously with identical inputs and configuration.
+func Unchanged(fd *models.FileData) bool {
+	if current == nil || fd == nil || abstractions.GetBool(keys.IgnoreState) {
+		return false
+	}
+
+	key := recordKey(fd.OriginalVideoPath, fd.MetaFilePath)
+	if key == "" {
+		return false
+	}
+
+	if current.configHash == "" {
+		return false
+	}
+
+	current.mu.Lock()
+	rec, exists := current.records[key]
+	current.mu.Unlock()
+	if !exists || rec.ConfigHash != current.configHash {
+		return false
+	}
+	return rec.Video == statFile(fd.OriginalVideoPath) && rec.Meta == statFile(fd.MetaFilePath)
+}
+
+// Record stores the final state of a successfully processed file pair.
+//
+// Pairs which failed in any stage are not recorded, so they're retried on the next run.
+func Record(fd *models.FileData) {
+	if current == nil || fd == nil || fd.Failed {
+		return
+	}
+
+	key := recordKey(fd.FinalVideoPath, fd.FinalMetaPath)
+	if key == "" {
+		return
+	}
+
+	rec := record{
+		Video:      statFile(fd.FinalVideoPath),
+		Meta:       statFile(fd.FinalMetaPath),
+		ConfigHash: current.configHash,
+		Updated:    time.Now(),
+	}
+
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	// Drop stale entry if the file was renamed.
+	if oldKey := recordKey(fd.OriginalVideoPath, fd.MetaFilePath); oldKey != key {
+		delete(current.records, oldKey)
+	}
+	current.records[key] = rec
+	current.dirty = true
+}
+
+// RecordFailure remembers the inputs of a pair which failed in watch mode, so it isn't retried until they change.
+func RecordFailure(fd *models.FileData) {
+	if current == nil || fd == nil || !abstractions.GetBool(keys.WatchMode) {
+		return
+	}
+
+	key := recordKey(fd.OriginalVideoPath, fd.MetaFilePath)
+	if key == "" {
+		return
+	}
+
+	rec := record{
+		Video:      statFile(fd.OriginalVideoPath),
+		Meta:       statFile(fd.MetaFilePath),
+		ConfigHash: current.configHash,
+		Updated:    time.Now(),
+	}
+
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.failures[key] = rec
+}
+
+// FailedUnchanged returns true if the pair failed earlier in watch mode, and its inputs haven't changed since.
+func FailedUnchanged(fd *models.FileData) bool {
+	if current == nil || fd == nil {
+		return false
+	}
+
+	key := recordKey(fd.OriginalVideoPath, fd.MetaFilePath)
+	if key == "" {
+		return false
+	}
+
+	current.mu.Lock()
+	rec, exists := current.failures[key]
+	current.mu.Unlock()
+	if !exists {
+		return false
+	}
+	if rec.Video == statFile(fd.OriginalVideoPath) && rec.Meta == statFile(fd.MetaFilePath) {
+		return true
+	}
+
+	current.mu.Lock()
+	delete(current.failures, key)
+	current.mu.Unlock()
+	return false
+}
+
+// Save writes the state file to disk if any records changed.
+func Save() error {
+	if current == nil {
+		return nil
+	}
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	if !current.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(current.records)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// Write to temp file and rename so an interrupted write can't corrupt the state.
+	tmpPath := current.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, consts.PermsJSONFile); err != nil {
+		return fmt.Errorf("failed to write state file %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, current.path); err != nil {
+		return fmt.Errorf("failed to replace state file %q: %w", current.path, err)
+	}
+	current.dirty = false
+	logger.Pl.D(1, "Saved %d state record(s) to %q", len(current.records), current.path)
+	return nil
+}
+
+// recordKey returns the absolute path used to identify a file pair.
+func recordKey(videoPath, metaPath string) string {
+	p := videoPath
+	if p == "" {
+		p = metaPath
+	}
+	if p == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// statFile returns the size and modification time of a file (zero value if missing).
+func statFile(path string) fileStat {
+	if path == "" {
+		return fileStat{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+	}
+}
+
+// hashConfig hashes the effective settings which affect file output.
+func hashConfig() string {
+	cfg := make(map[string]any, len(configKeys))
+	for _, k := range configKeys {
+		if abstractions.IsSet(k) {
+			cfg[k] = abstractions.Get(k)
+		}
+	}
+
+	// JSON map keys are sorted, so output is stable.
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		logger.Pl.E("Could not hash configuration, state will not match: %v", err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -15,17 +15,22 @@ import (
 	"metarr/internal/metadata/metawriters"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
+	"metarr/internal/plan"
+	"metarr/internal/report"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 )
 
-var filenameTaken sync.Map
 var fileRenameMuMap sync.Map
 
+// Rename targets chosen but not yet written, so files renamed concurrently don't pick the same name.
+var (
+	claimsMu sync.Mutex
+	claimed  = make(map[string]bool)
+)
+
 // fileProcessor handles the renaming and moving of files.
 type fileProcessor struct {
 	fd            *models.FileData
@@ -34,12 +39,12 @@ type fileProcessor struct {
 	metadata      map[string]any
 	skipVideos    bool
 	outputDir     string
+	claims        []string // Rename targets reserved by this file pair.
 }
 
-// RenameFiles begins file renaming operations for a batch.
-func RenameFiles(ctx context.Context, fdArray []*models.FileData) error {
+// RenameFile renames, moves and purges a single file pair once its processing is done.
+func RenameFile(ctx context.Context, fd *models.FileData, skipVideos bool) error {
 	var replaceStyle enums.ReplaceToStyle
-	skipVideos := abstractions.GetBool(keys.SkipVideos)
 
 	// Check rename style.
 	if abstractions.IsSet(keys.Rename) {
@@ -50,44 +55,25 @@ func RenameFiles(ctx context.Context, fdArray []*models.FileData) error {
 			return fmt.Errorf("%s invalid rename style type %T", consts.LogTagDevError, replaceStyle)
 		}
 	}
-	// Create a copy to sort.
-	sortedFiles := make([]*models.FileData, 0, len(fdArray))
-	for _, fd := range fdArray {
-		if fd != nil {
-			sortedFiles = append(sortedFiles, fd)
-		}
-	}
-	// Sort alphabetically by meta path.
-	sort.Slice(sortedFiles, func(i, j int) bool {
-		return sortedFiles[i].MetaFilePath < sortedFiles[j].MetaFilePath
-	})
-	// Iterate over sorted list.
-	processedDirs := make(map[string]bool)
-	for _, fd := range sortedFiles {
-		if fd == nil {
-			continue
-		}
-		// Rename.
-		if err := renameFile(ctx, fd, replaceStyle, skipVideos); err != nil {
-			vars.AddToErrorArray(err)
-			logger.Pl.E("Failed to rename file %q: %v", fd.OriginalVideoPath, err)
-			continue
-		}
-		// Track directory for success message.
-		var directory string
-		if fd.MetaDirectory != "" {
-			directory = fd.MetaDirectory
-		} else if fd.VideoDirectory != "" {
-			directory = fd.VideoDirectory
-		}
-		if directory != "" {
-			processedDirs[directory] = true
+
+	// Rename.
+	if err := renameFile(ctx, fd, replaceStyle, skipVideos); err != nil {
+		fd.Failed = true
+		name := fd.OriginalVideoPath
+		if name == "" {
+			name = fd.MetaFilePath
 		}
+		vars.AddError(vars.ErrRename, name, err)
+		report.AddError(fd, report.StageRename, err)
+		logger.Pl.E("Failed to rename file %q: %v", fd.OriginalVideoPath, err)
+		return err
 	}
-	// Log success per directory.
-	for dir := range processedDirs {
-		logger.Pl.S("Successfully formatted file names in directory: %s", dir)
+
+	final := fd.FinalVideoPath
+	if final == "" {
+		final = fd.FinalMetaPath
 	}
+	logger.Pl.S("Finished file: %s", final)
 	return nil
 }
 
@@ -111,6 +97,7 @@ func renameFile(ctx context.Context, fileData *models.FileData, style enums.Repl
 		metatagParser: parsing.NewMetaTemplateParser(fileData.MetaFilePath),
 		outputDir:     outputDir,
 	}
+	defer fp.releaseClaims()
 
 	metaFile, err := os.Open(fp.fd.MetaFilePath)
 	if err != nil {
@@ -230,6 +217,11 @@ func (fp *fileProcessor) writeResult() error {
 		}
 	}
 
+	// Keep a Kodi thumbnail beside the video.
+	if err := file.MoveKodiThumbnail(fp.fd, finalVideoPath); err != nil {
+		logger.Pl.E("Failed to move thumbnail for %q: %v", finalVideoPath, err)
+	}
+
 	// Set final paths at this terminal boundary.
 	fp.fd.SetFinalPaths(finalVideoPath, finalMetaPath)
 
@@ -412,26 +404,27 @@ func (fp *fileProcessor) constructNewNames(fileBase string, style enums.ReplaceT
 
 // getUniqueFilename appends numbers onto a filename if the filename already exists.
 func (fp *fileProcessor) getUniqueFilename(newBase, oldBase string) (uniqueFilename string, err error) {
-	if newBase == oldBase {
+	// Files moved to an output directory may still collide with others there.
+	if newBase == oldBase && fp.outputDir == "" {
 		return newBase, nil
 	}
 
-	var dir, ext string
+	var dir, srcDir, ext string
 	vExt := filepath.Ext(fp.fd.PostFFmpegVideoPath)
 	jExt := filepath.Ext(fp.fd.MetaFilePath)
 
 	// Check in the final output directory first if set.
 	if fp.outputDir != "" && vExt != "" {
-		dir = fp.outputDir
+		dir, srcDir = fp.outputDir, fp.fd.VideoDirectory
 		ext = vExt
 	} else if fp.fd.VideoDirectory != "" && vExt != "" {
-		dir = fp.fd.VideoDirectory
+		dir, srcDir = fp.fd.VideoDirectory, fp.fd.VideoDirectory
 		ext = vExt
 	} else if fp.outputDir != "" && jExt != "" {
-		dir = fp.outputDir
+		dir, srcDir = fp.outputDir, fp.fd.MetaDirectory
 		ext = jExt
 	} else if fp.fd.MetaDirectory != "" && jExt != "" {
-		dir = fp.fd.MetaDirectory
+		dir, srcDir = fp.fd.MetaDirectory, fp.fd.MetaDirectory
 		ext = jExt
 	}
 
@@ -439,6 +432,9 @@ func (fp *fileProcessor) getUniqueFilename(newBase, oldBase string) (uniqueFilen
 		return oldBase, fmt.Errorf("no directory, cannot check for uniqueness")
 	}
 
+	// If target is the current name, use it (can overwrite self).
+	currentPath := filepath.Clean(filepath.Join(srcDir, oldBase+ext))
+
 	getMu, _ := fileRenameMuMap.LoadOrStore(newBase, &sync.Mutex{})
 	mu, ok := getMu.(*sync.Mutex)
 	if !ok {
@@ -447,28 +443,61 @@ func (fp *fileProcessor) getUniqueFilename(newBase, oldBase string) (uniqueFilen
 	mu.Lock()
 	defer mu.Unlock()
 
-	counter, _ := filenameTaken.LoadOrStore(newBase, &atomic.Int32{})
+	// Number from 1 on each call, claims keep concurrent renames from taking the same name.
+	n := 0
 	for {
 		candidate := newBase
 		targetPath := filepath.Join(dir, candidate+ext)
 
-		// Check if target exists.
-		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+		// Check if target exists (or is already claimed).
+		if targetPath == currentPath || fp.claim(targetPath) {
 			return candidate, nil
 		}
 
-		n := counter.(*atomic.Int32).Add(1)
+		n++
 		candidate = fmt.Sprintf("%s (%d)", newBase, n)
-
-		// If target is the current name, use it (can overwrite self).
-		currentPath := filepath.Join(dir, oldBase+ext)
 		newTargetPath := filepath.Join(dir, candidate+ext)
 
 		// Check if target exists.
-		if _, err := os.Stat(newTargetPath); os.IsNotExist(err) || newTargetPath == currentPath {
+		if newTargetPath == currentPath || fp.claim(newTargetPath) {
 			return candidate, nil
 		}
 
 		logger.Pl.D(2, "File %s already exists, trying next number", targetPath)
 	}
 }
+
+// claim reserves a rename target if no file exists there and no other pair has claimed it (or planned it in dry-run mode).
+func (fp *fileProcessor) claim(path string) bool {
+	path = filepath.Clean(path)
+
+	claimsMu.Lock()
+	if claimed[path] {
+		claimsMu.Unlock()
+		return false
+	}
+	claimed[path] = true
+	claimsMu.Unlock()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) || !plan.ClaimPath(path) {
+		releaseClaim(path)
+		return false
+	}
+	fp.claims = append(fp.claims, path)
+	return true
+}
+
+// releaseClaims frees the pair's rename targets once its files are written (or failed), after which the filesystem is checked instead.
+func (fp *fileProcessor) releaseClaims() {
+	for _, path := range fp.claims {
+		releaseClaim(path)
+	}
+	fp.claims = nil
+}
+
+// releaseClaim frees a rename target.
+func releaseClaim(path string) {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	delete(claimed, path)
+}
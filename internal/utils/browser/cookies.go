@@ -7,7 +7,9 @@ import (
 	"metarr/internal/domain/logger"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/browserutils/kooky"
 	// Use cookies from all browsers.
@@ -18,6 +20,7 @@ import (
 )
 
 var (
+	cookiesMu  sync.Mutex // Guards the stores and cookies, as metadata workers scrape concurrently.
 	allStores  []kooky.CookieStore
 	allCookies []*http.Cookie
 )
@@ -48,6 +51,8 @@ func getBrowserCookies(u string) ([]*http.Cookie, error) {
 	}
 
 	// Otherwise, proceed to use browser cookie stores.
+	cookiesMu.Lock()
+	defer cookiesMu.Unlock()
 	if allStores == nil || allCookies == nil || len(allCookies) == 0 {
 		initializeCookies()
 	}
@@ -82,7 +87,7 @@ func getBrowserCookies(u string) ([]*http.Cookie, error) {
 		logger.Pl.I("Found a total of %d cookies for %q", len(allCookies), u)
 	}
 
-	return allCookies, nil
+	return slices.Clone(allCookies), nil
 }
 
 // convertToHTTPCookies converts kooky cookies to http.Cookie format.
@@ -7,6 +7,7 @@ import (
 	"metarr/internal/domain/consts"
 	"metarr/internal/domain/enums"
 	"metarr/internal/domain/logger"
+	"metarr/internal/domain/vars"
 	"metarr/internal/models"
 	"metarr/internal/utils/browser/browsepreset"
 	"net/http"
@@ -34,10 +35,13 @@ func ScrapeMeta(w *models.MetadataWebData, find enums.WebClassTags) string {
 	if err != nil {
 		logger.Pl.E("Was unable to grab browser cookies: %v", err)
 	}
-	for _, try := range w.TryURLs {
+	for i, try := range w.TryURLs {
 		data, err = scrape(try, w.Cookies, find, false)
 		if err != nil {
 			logger.Pl.E("Failed to scrape %q for requested metadata: %v", try, err)
+			if i == len(w.TryURLs)-1 {
+				vars.AddError(vars.ErrScrape, try, err)
+			}
 		} else {
 			break
 		}
@@ -9,7 +9,9 @@ import (
 	"metarr/internal/domain/keys"
 	"metarr/internal/domain/logger"
 	"metarr/internal/models"
+	"net/url"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
@@ -232,6 +234,13 @@ func ValidateAndSetConcurrencyLimit(c int) int {
 	return c
 }
 
+// ValidateAndSetMetaConcurrencyLimit checks and ensures correct metadata concurrency limit input.
+func ValidateAndSetMetaConcurrencyLimit(c int) int {
+	c = sharedvalidation.ValidateConcurrencyLimit(c)
+	abstractions.Set(keys.MetaConcurrency, c)
+	return c
+}
+
 // ValidateAndSetMinFreeMem flag verifies the format of the free memory flag.
 func ValidateAndSetMinFreeMem(minFreeMem string) {
 	if minFreeMem == "" || minFreeMem == "0" {
@@ -293,6 +302,117 @@ func ValidateAndSetMaxCPU(maxCPU float64) {
 	abstractions.Set(keys.MaxCPU, sharedvalidation.ValidateMaxCPU(maxCPU, false))
 }
 
+// ValidateAndSetVerifyDurationTolerance sets the allowed duration difference for output verification.
+func ValidateAndSetVerifyDurationTolerance(tolerance float64) {
+	if tolerance < 0 {
+		logger.Pl.E("Verification duration tolerance %.2f is negative, using 0", tolerance)
+		tolerance = 0
+	}
+	abstractions.Set(keys.VerifyDurationTolerance, tolerance)
+}
+
+// ValidateAndSetLanguages normalizes a stream language filter (lowercase, "" and "und" are untagged).
+func ValidateAndSetLanguages(viperKey string, langs []string) {
+	out := make([]string, 0, len(langs))
+	for _, l := range langs {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" {
+			continue
+		}
+		if !slices.Contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	abstractions.Set(viperKey, out)
+}
+
+// ValidateAndSetDropStreamTypes checks the stream types to drop (video streams can't be dropped).
+func ValidateAndSetDropStreamTypes(types []string) error {
+	valid := []string{models.StreamAudio, models.StreamSubtitle, models.StreamData, models.StreamAttachment}
+
+	out := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch t {
+		case "":
+			continue
+		case "subtitles", "subs":
+			t = models.StreamSubtitle
+		case "attachments":
+			t = models.StreamAttachment
+		}
+		if !slices.Contains(valid, t) {
+			return fmt.Errorf("invalid stream type %q to drop, accepted values: %v", t, valid)
+		}
+		out = append(out, t)
+	}
+	abstractions.Set(keys.DropStreamTypes, out)
+	return nil
+}
+
+// ValidateAndSetDropDispositions checks the stream dispositions to drop, resolving aliases to FFprobe names.
+func ValidateAndSetDropDispositions(dispositions []string) error {
+	valid := []string{"comment", "hearing_impaired", "visual_impaired", "forced", "default"}
+
+	out := make([]string, 0, len(dispositions))
+	for _, d := range dispositions {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch d {
+		case "":
+			continue
+		case "commentary":
+			d = "comment"
+		case "sdh":
+			d = "hearing_impaired"
+		case "descriptive", "audio_description":
+			d = "visual_impaired"
+		}
+		if !slices.Contains(valid, d) {
+			return fmt.Errorf("invalid stream disposition %q to drop, accepted values: %v", d, valid)
+		}
+		out = append(out, d)
+	}
+	abstractions.Set(keys.DropDispositions, out)
+	return nil
+}
+
+// ValidateAndSetSubtitleSidecars checks the action for subtitle files after muxing ('keep', 'delete', or 'move:<dir>').
+func ValidateAndSetSubtitleSidecars(action string) error {
+	action = strings.TrimSpace(action)
+	name, dir, _ := strings.Cut(action, ":")
+	name = strings.ToLower(name)
+
+	switch name {
+	case "", "keep":
+		action = "keep"
+	case "delete":
+		action = name
+	case "move":
+		if dir = strings.TrimSpace(dir); dir == "" {
+			return fmt.Errorf("subtitle sidecar action 'move' needs a directory (e.g. 'move:subs')")
+		}
+		action = name + ":" + filepath.Clean(dir)
+	default:
+		return fmt.Errorf("invalid subtitle sidecar action %q, accepted values: keep, delete, move:<dir>", action)
+	}
+	abstractions.Set(keys.SubtitleSidecars, action)
+	return nil
+}
+
+// ValidateAndSetThumbnailSidecars checks the action for local thumbnail images after embedding ('keep', 'delete', or 'kodi').
+func ValidateAndSetThumbnailSidecars(action string) error {
+	action = strings.ToLower(strings.TrimSpace(action))
+	switch action {
+	case "":
+		action = "keep"
+	case "keep", "delete", "kodi":
+	default:
+		return fmt.Errorf("invalid thumbnail sidecar action %q, accepted values: keep, delete, kodi", action)
+	}
+	abstractions.Set(keys.ThumbnailSidecars, action)
+	return nil
+}
+
 // ValidateAndSetOutputFiletype verifies the output filetype is valid for FFmpeg.
 func ValidateAndSetOutputFiletype(o string) {
 	var err error
@@ -400,6 +520,78 @@ func ValidateAndSetFileFilters(viperKey string, argsInputPrefixes []string) {
 	}
 }
 
+// ValidateAndSetMaxDepth sets the directory recursion depth (negative values are unlimited).
+func ValidateAndSetMaxDepth(depth int) {
+	if depth < 0 {
+		depth = -1
+	}
+	abstractions.Set(keys.MaxDepth, depth)
+}
+
+// ValidateAndSetExcludeDirs checks that the directory exclusion patterns are valid globs.
+func ValidateAndSetExcludeDirs(patterns []string) error {
+	excludes := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid directory exclusion pattern %q: %w", p, err)
+		}
+		excludes = append(excludes, filepath.Clean(p))
+	}
+	abstractions.Set(keys.ExcludeDirs, excludes)
+	return nil
+}
+
+// ValidateAndSetMatchStrategies checks the video and metafile pairing strategies.
+func ValidateAndSetMatchStrategies(strategies []string) error {
+	out := make([]string, 0, len(strategies))
+	for _, s := range strategies {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch s {
+		case "":
+			continue
+		case "exact", "tag-id", "json-id", "fuzzy":
+		case "id":
+			s = "tag-id"
+		default:
+			return fmt.Errorf("invalid match strategy %q, accepted values are: exact, tag-id, json-id, fuzzy", s)
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, "exact")
+	}
+	abstractions.Set(keys.MatchStrategies, out)
+	return nil
+}
+
+// ValidateAndSetMatchThreshold checks the fuzzy pairing similarity threshold is between 0 and 1.
+func ValidateAndSetMatchThreshold(threshold float64) error {
+	if threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("invalid match threshold %v, must be above 0 and at most 1", threshold)
+	}
+	abstractions.Set(keys.MatchThreshold, threshold)
+	return nil
+}
+
+// ValidateAndSetEventsURL checks the event push endpoint is an HTTP(S) URL.
+func ValidateAndSetEventsURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid events URL %q: %w", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid events URL %q, must be an http:// or https:// URL", rawURL)
+	}
+	abstractions.Set(keys.EventsURL, u.String())
+	return nil
+}
+
 // ValidateAndSetTranscodeQuality validates the transcode quality preset.
 func ValidateAndSetTranscodeQuality(q string) error {
 	if q == "" {
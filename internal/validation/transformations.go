@@ -8,6 +8,7 @@ import (
 	"metarr/internal/domain/logger"
 	"metarr/internal/models"
 	"metarr/internal/parsing"
+	"regexp"
 	"strings"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
@@ -342,6 +343,41 @@ func ValidateAndSetFilenameOps(filenameOpsInput []string) error {
 	return nil
 }
 
+// ValidateAndSetFilenamePatterns compiles filename patterns into regular expressions.
+//
+// Patterns containing named groups are used as regexes, otherwise '{field}' placeholders are expanded.
+func ValidateAndSetFilenamePatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		expr := p
+		if !strings.Contains(p, "(?P<") && !strings.Contains(p, "(?<") {
+			var err error
+			if expr, err = filenameTemplateRegex(p); err != nil {
+				return err
+			}
+		}
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid filename pattern %q: %w", p, err)
+		}
+		if rx.NumSubexp() == 0 {
+			return fmt.Errorf("filename pattern %q has no fields to capture", p)
+		}
+		compiled = append(compiled, rx)
+	}
+	if len(compiled) == 0 {
+		return nil
+	}
+	logger.Pl.I("Added %d filename patterns: %v", len(compiled), compiled)
+
+	abstractions.Set(keys.FilenamePatternModels, compiled)
+	return nil
+}
+
 // ** Private ************************************************************************************************************************************
 
 // dateEnum returns the date format enum type.
@@ -377,3 +413,43 @@ func dateEnum(dateFmt string) (formatEnum enums.DateFormat, err error) {
 		return enums.DateFmtSkip, fmt.Errorf("invalid date format entered as %q, please enter up to three ymd characters (where capital Y is yyyy and y is yy)", dateFmt)
 	}
 }
+
+// filenameTemplateRegex converts a '{uploader} - {title} [{id}]' style pattern into an anchored regex.
+func filenameTemplateRegex(pattern string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('^')
+
+	rest := pattern
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open == -1 {
+			b.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		b.WriteString(regexp.QuoteMeta(rest[:open]))
+
+		closing := strings.IndexByte(rest[open:], '}')
+		if closing == -1 {
+			return "", fmt.Errorf("filename pattern %q has an unclosed '{'", pattern)
+		}
+		name := strings.TrimSpace(rest[open+1 : open+closing])
+		if name == "" || !isFieldName(name) {
+			return "", fmt.Errorf("filename pattern %q has invalid field name %q", pattern, name)
+		}
+		b.WriteString("(?P<" + name + ">.+?)")
+		rest = rest[open+closing+1:]
+	}
+
+	b.WriteByte('$')
+	return b.String(), nil
+}
+
+// isFieldName checks a pattern field name only contains letters, digits and underscores.
+func isFieldName(name string) bool {
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,347 @@
+// Package watch runs Metarr as a daemon, processing files once they finish downloading.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"metarr/internal/domain/consts"
+	"metarr/internal/domain/logger"
+	"metarr/internal/file"
+	"metarr/internal/journal"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// checkInterval is how often pending files are checked for changes.
+const checkInterval = time.Second
+
+// pendingFile is a file which has not yet been stable for the settle time.
+type pendingFile struct {
+	size  int64
+	mod   time.Time
+	since time.Time // When the file was last seen to change.
+}
+
+// ownFile is a file Metarr wrote, as it was when the pass which wrote it finished.
+type ownFile struct {
+	size int64
+	mod  time.Time
+}
+
+// watcher tracks files which are still being written in the watched directories.
+//
+// Pending files are held (see file.Hold) for as long as they're pending, so passes which are already
+// running skip pairs that start downloading mid-pass. Files Metarr writes itself are ignored until
+// something else changes them.
+type watcher struct {
+	fsw     *fsnotify.Watcher
+	settle  time.Duration
+	pending map[string]*pendingFile
+	own     map[string]ownFile // Files written by finished passes.
+
+	passMu  sync.Mutex
+	passOwn map[string]bool // Files written by the running pass, from its journal.
+}
+
+// Run watches the directories, calling process each time new files have settled.
+//
+// Files are settled once their size and modification time have not changed for the settle duration.
+// While any file of a pair is still pending (including partial downloads such as '.part' files), the
+// pair is held back from processing. Passes run in the background, so events keep being handled while
+// files are processed. Run returns when the context is cancelled and the running pass has finished.
+func Run(ctx context.Context, dirs []string, settle time.Duration, process func(context.Context)) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{
+		fsw:     fsw,
+		settle:  settle,
+		pending: make(map[string]*pendingFile),
+		own:     make(map[string]ownFile),
+		passOwn: make(map[string]bool),
+	}
+	defer w.releaseAll()
+
+	journal.SetHook(w.recordOwn)
+	defer journal.SetHook(nil)
+	for _, dir := range dirs {
+		if err := w.addTree(dir, time.Now().Add(-settle)); err != nil {
+			return err
+		}
+	}
+
+	var (
+		passDone chan struct{} // Open while a pass is running.
+		rerun    bool          // Files settled during the running pass.
+	)
+	startPass := func() {
+		if ctx.Err() != nil {
+			return
+		}
+		passDone = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			process(ctx)
+		}(passDone)
+	}
+	defer func() {
+		if passDone != nil {
+			<-passDone
+		}
+	}()
+
+	// Process what is already complete.
+	startPass()
+	logger.Pl.I("Watching %d director(ies) for new files (settle time %v)...", len(dirs), settle)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Pl.I("Stopped watching for new files")
+			return nil
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Pl.E("File watcher error: %v", err)
+
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.handleEvent(ev)
+
+		case <-passDone:
+			passDone = nil
+			w.endPass()
+			if rerun {
+				rerun = false
+				startPass()
+			}
+
+		case <-ticker.C:
+			if !w.check() {
+				continue
+			}
+			if passDone != nil {
+				rerun = true // Picked up once the running pass finishes.
+				continue
+			}
+			startPass()
+		}
+	}
+}
+
+// handleEvent registers new directories and marks changed files as pending.
+func (w *watcher) handleEvent(ev fsnotify.Event) {
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+	info, err := os.Stat(ev.Name)
+	if err != nil {
+		return // Already gone.
+	}
+
+	if info.IsDir() {
+		if ev.Has(fsnotify.Create) {
+			if err := w.addTree(ev.Name, time.Time{}); err != nil {
+				logger.Pl.E("Failed to watch new directory %q: %v", ev.Name, err)
+			}
+		}
+		return
+	}
+	w.touch(ev.Name, info)
+}
+
+// addTree watches a directory and its subdirectories.
+//
+// Files modified after 'since' (or partial downloads) are marked as pending.
+func (w *watcher) addTree(root string, since time.Time) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Pl.W("Cannot watch %q: %v", path, err)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := w.fsw.Add(path); err != nil {
+				return fmt.Errorf("failed to watch directory %q: %w", path, err)
+			}
+			logger.Pl.D(2, "Watching directory %q", path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if file.IsPartial(path) || info.ModTime().After(since) {
+			w.touch(path, info)
+		}
+		return nil
+	})
+}
+
+// touch marks a file as changed, unless Metarr wrote it.
+func (w *watcher) touch(path string, info os.FileInfo) {
+	if isWorkFile(path) || w.isOwn(path, info) {
+		return
+	}
+	if p, ok := w.pending[path]; ok && p.size == info.Size() && p.mod.Equal(info.ModTime()) {
+		return
+	}
+	if _, ok := w.pending[path]; !ok {
+		logger.Pl.D(1, "Waiting for %q to settle", path)
+		file.Hold(path)
+	}
+	w.pending[path] = &pendingFile{
+		size:  info.Size(),
+		mod:   info.ModTime(),
+		since: time.Now(),
+	}
+}
+
+// check updates pending files, returning true if any have settled and are not held back by another pending file.
+func (w *watcher) check() (ready bool) {
+	now := time.Now()
+	var settled []string
+	for path, p := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			w.remove(path) // Removed or renamed (e.g. '.part' file completed).
+			continue
+		}
+		if w.writtenInPass(path) {
+			w.remove(path) // Seen before the pass journaled it.
+			continue
+		}
+		if info.Size() != p.size || !info.ModTime().Equal(p.mod) {
+			p.size, p.mod, p.since = info.Size(), info.ModTime(), now
+			continue
+		}
+		if !file.IsPartial(path) && now.Sub(p.since) >= w.settle {
+			logger.Pl.D(1, "File %q has settled", path)
+			w.remove(path)
+			settled = append(settled, path)
+		}
+	}
+	if len(settled) == 0 {
+		return false
+	}
+
+	// Files whose pair is still being written are picked up with it later.
+	held := w.heldPairs()
+	for _, path := range settled {
+		if !held[file.PairKey(path)] {
+			return true
+		}
+	}
+	return false
+}
+
+// remove stops tracking a pending file.
+func (w *watcher) remove(path string) {
+	delete(w.pending, path)
+	file.Release(path)
+}
+
+// releaseAll stops tracking all pending files.
+func (w *watcher) releaseAll() {
+	for path := range w.pending {
+		w.remove(path)
+	}
+}
+
+// heldPairs returns the pair keys of pending files.
+func (w *watcher) heldPairs() map[string]bool {
+	held := make(map[string]bool, len(w.pending))
+	for path := range w.pending {
+		held[file.PairKey(path)] = true
+	}
+	return held
+}
+
+// isWorkFile returns true for Metarr's temporary, swap and backup files.
+func isWorkFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, consts.TempTag) ||
+		strings.Contains(base, consts.SwapTag) ||
+		strings.Contains(base, consts.BackupTag)
+}
+
+// recordOwn notes the paths changed by a journal entry of the running pass.
+func (w *watcher) recordOwn(e journal.Entry) {
+	w.passMu.Lock()
+	defer w.passMu.Unlock()
+	for _, p := range []string{e.Src, e.Dst} {
+		if p != "" {
+			w.passOwn[p] = true
+		}
+	}
+}
+
+// isOwn returns true if Metarr wrote the file and nothing has changed it since.
+func (w *watcher) isOwn(path string, info os.FileInfo) bool {
+	if w.writtenInPass(path) {
+		return true
+	}
+
+	o, ok := w.own[path]
+	if !ok {
+		return false
+	}
+	if o.size == info.Size() && o.mod.Equal(info.ModTime()) {
+		return true
+	}
+	delete(w.own, path) // Changed by something else.
+	return false
+}
+
+// writtenInPass returns true if the running pass wrote the file.
+func (w *watcher) writtenInPass(path string) bool {
+	w.passMu.Lock()
+	defer w.passMu.Unlock()
+	return w.passOwn[path]
+}
+
+// endPass keeps the files written by the finished pass as they are now, so later events for them are ignored.
+func (w *watcher) endPass() {
+	w.passMu.Lock()
+	written := w.passOwn
+	w.passOwn = make(map[string]bool)
+	w.passMu.Unlock()
+
+	// Forget files which have since been moved or removed.
+	for path := range w.own {
+		if _, err := os.Stat(path); err != nil {
+			delete(w.own, path)
+		}
+	}
+
+	for path := range written {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		w.own[path] = ownFile{size: info.Size(), mod: info.ModTime()}
+		if _, ok := w.pending[path]; ok {
+			w.remove(path)
+		}
+	}
+}
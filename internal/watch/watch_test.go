@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"metarr/internal/journal"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsWorkFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/dl/Title.mp4", false},
+		{"/dl/tmp_Title.mp4.mkv", true},
+		{"/dl/Title_metarrswap.mp4", true},
+		{"/dl/Title_metarrbackup.mp4", true},
+		{"/dl/tmp_dir/Title.mp4", false},
+	}
+	for _, tt := range tests {
+		if got := isWorkFile(tt.path); got != tt.want {
+			t.Errorf("isWorkFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsOwn(t *testing.T) {
+	dir := t.TempDir()
+	written := filepath.Join(dir, "Title.mkv")
+	other := filepath.Join(dir, "Other.mkv")
+	for _, p := range []string{written, other} {
+		if err := os.WriteFile(p, []byte("video"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &watcher{
+		pending: make(map[string]*pendingFile),
+		own:     make(map[string]ownFile),
+		passOwn: make(map[string]bool),
+	}
+	w.recordOwn(journal.Entry{Op: journal.OpRename, Src: filepath.Join(dir, "Title.mp4"), Dst: written})
+
+	tests := []struct {
+		name   string
+		before func()
+		path   string
+		want   bool
+	}{
+		{"written during the pass", nil, written, true},
+		{"not written", nil, other, false},
+		{"unchanged after the pass", w.endPass, written, true},
+		{"changed after the pass", func() {
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(written, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, written, false},
+		{"forgotten once changed", func() {
+			past := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(written, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}, written, false},
+	}
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+		info, err := os.Stat(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.isOwn(tt.path, info); got != tt.want {
+			t.Errorf("%s: isOwn(%q) = %v, want %v", tt.name, tt.path, got, tt.want)
+		}
+	}
+}